@@ -34,6 +34,10 @@ var DefaultCollapseSidebar = false // default value of collapse sidebar
 var SessionSecret = uuid.New().String()
 var CryptoSecret = uuid.New().String()
 
+// CryptoSecretConfigured 是否显式设置了 CRYPTO_SECRET 或 SESSION_SECRET，
+// 未设置时 CryptoSecret 每次启动随机生成，以其计算的 key 哈希重启后失效
+var CryptoSecretConfigured = false
+
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
 
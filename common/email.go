@@ -0,0 +1,75 @@
+package common
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+func generateMessageID() string {
+	domain := strings.Split(SMTPAccount, "@")
+	if len(domain) < 2 {
+		return fmt.Sprintf("<%d.%s>", time.Now().UnixNano(), GetRandomString(12))
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), GetRandomString(12), domain[1])
+}
+
+// SendEmail 通过系统设置中的 SMTP 账号发送 HTML 邮件
+func SendEmail(subject string, receiver string, content string) error {
+	if SMTPServer == "" || SMTPAccount == "" {
+		return fmt.Errorf("SMTP 服务器未配置")
+	}
+	if SMTPFrom == "" {
+		SMTPFrom = SMTPAccount
+	}
+	encodedSubject := fmt.Sprintf("=?UTF-8?B?%s?=", base64.StdEncoding.EncodeToString([]byte(subject)))
+	mail := []byte(fmt.Sprintf("To: %s\r\n"+
+		"From: %s<%s>\r\n"+
+		"Subject: %s\r\n"+
+		"Date: %s\r\n"+
+		"Message-ID: %s\r\n"+
+		"Content-Type: text/html; charset=UTF-8\r\n\r\n%s\r\n",
+		receiver, SystemName, SMTPFrom, encodedSubject, time.Now().Format(time.RFC1123Z), generateMessageID(), content))
+	auth := smtp.PlainAuth("", SMTPAccount, SMTPToken, SMTPServer)
+	addr := fmt.Sprintf("%s:%d", SMTPServer, SMTPPort)
+	to := strings.Split(receiver, ";")
+
+	if SMTPPort != 465 && !SMTPSSLEnabled {
+		return smtp.SendMail(addr, auth, SMTPFrom, to, mail)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: SMTPServer})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, SMTPServer)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = client.Auth(auth); err != nil {
+		return err
+	}
+	if err = client.Mail(SMTPFrom); err != nil {
+		return err
+	}
+	for _, receiver := range to {
+		if err = client.Rcpt(receiver); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(mail); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
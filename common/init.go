@@ -18,13 +18,15 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "./logs", "specify the log directory")
+
+	MigrateTokenKeys = flag.Bool("migrate-token-keys", false, "backfill api key hashes, clear plaintext keys and exit")
 )
 
 func printHelp() {
 	fmt.Println("NewAPI(Based OneAPI) " + Version + " - The next-generation LLM gateway and AI asset management system supports multiple languages.")
 	fmt.Println("Original Project: OneAPI by JustSong - https://github.com/songquanpeng/one-api")
 	fmt.Println("Maintainer: QuantumNous - https://github.com/QuantumNous/new-api")
-	fmt.Println("Usage: newapi [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: newapi [--port <port>] [--log-dir <log directory>] [--migrate-token-keys] [--version] [--help]")
 }
 
 func InitEnv() {
@@ -55,6 +57,7 @@ func InitEnv() {
 	} else {
 		CryptoSecret = SessionSecret
 	}
+	CryptoSecretConfigured = os.Getenv("CRYPTO_SECRET") != "" || os.Getenv("SESSION_SECRET") != ""
 	if os.Getenv("SQLITE_PATH") != "" {
 		SQLitePath = os.Getenv("SQLITE_PATH")
 	}
@@ -122,6 +125,66 @@ func initConstantEnv() {
 	constant.GenerateDefaultToken = GetEnvOrDefaultBool("GENERATE_DEFAULT_TOKEN", false)
 	// 是否启用错误日志
 	constant.ErrorLogEnabled = GetEnvOrDefaultBool("ERROR_LOG_ENABLED", false)
+	// 令牌兼容模式，明文 key 全部迁移为 key_hash 后可关闭
+	constant.TokenLegacyKeyLookup = GetEnvOrDefaultBool("TOKEN_LEGACY_KEY_LOOKUP", true)
+	// 令牌 key 轮换默认宽限期，默认 7 天
+	constant.TokenRotationGracePeriodSeconds = GetEnvOrDefault("TOKEN_ROTATION_GRACE_PERIOD", 7*24*60*60)
+	// 令牌消费额度重置时区，默认使用服务器本地时区
+	constant.TokenSpendingTimezone = GetEnvOrDefaultString("TOKEN_SPENDING_TIMEZONE", "Local")
+	// 管理 API 认证，两者都未配置时拒绝所有管理请求
+	constant.AdminSecret = GetEnvOrDefaultString("ADMIN_SECRET", "")
+	constant.AdminHmacSecrets = parseAdminHmacSecrets(GetEnvOrDefaultString("ADMIN_HMAC_SECRETS", ""))
+	constant.AdminSignatureMaxSkewSeconds = GetEnvOrDefault("ADMIN_SIGNATURE_MAX_SKEW", 300)
+	// 客户端 IP 识别：TRUSTED_PROXIES=none 表示不信任任何代理，直接使用连接地址
+	if trustedProxies := strings.TrimSpace(GetEnvOrDefaultString("TRUSTED_PROXIES", "")); trustedProxies != "" {
+		constant.TrustedProxies = []string{}
+		if trustedProxies != "none" {
+			constant.TrustedProxies = splitAndTrim(trustedProxies)
+		}
+	}
+	constant.RemoteIPHeaders = splitAndTrim(GetEnvOrDefaultString("REMOTE_IP_HEADERS", "X-Forwarded-For,X-Real-IP"))
+	// 令牌生命周期巡检，仅在主节点运行
+	constant.TokenLifecycleSweepInterval = GetEnvOrDefault("TOKEN_LIFECYCLE_SWEEP_INTERVAL", 300)
+	constant.TokenExpiryNotifyDays = GetEnvOrDefault("TOKEN_EXPIRY_NOTIFY_DAYS", 3)
+	// 子令牌（JWT），默认最长 1 小时
+	constant.ChildTokenSecret = GetEnvOrDefaultString("CHILD_TOKEN_SECRET", "")
+	constant.ChildTokenMaxTTLSeconds = GetEnvOrDefault("CHILD_TOKEN_MAX_TTL", 60*60)
+	// 渠道健康度加权
+	constant.ChannelHealthEnabled = GetEnvOrDefaultBool("CHANNEL_HEALTH_ENABLED", true)
+	constant.ChannelHealthEwmaAlpha = GetEnvOrDefaultFloat("CHANNEL_HEALTH_EWMA_ALPHA", 0.1)
+	constant.ChannelHealthMinWeightFactor = GetEnvOrDefaultFloat("CHANNEL_HEALTH_MIN_WEIGHT_FACTOR", 0.05)
+	constant.ChannelHealthHalfLifeSeconds = GetEnvOrDefault("CHANNEL_HEALTH_HALF_LIFE", 300)
+	constant.ChannelHealthSyncIntervalSeconds = GetEnvOrDefault("CHANNEL_HEALTH_SYNC_INTERVAL", 5)
+	// 渠道熔断
+	constant.ChannelBreakerEnabled = GetEnvOrDefaultBool("CHANNEL_BREAKER_ENABLED", true)
+	constant.ChannelBreakerFailureThreshold = GetEnvOrDefault("CHANNEL_BREAKER_FAILURE_THRESHOLD", 5)
+	constant.ChannelBreakerOpenSeconds = GetEnvOrDefault("CHANNEL_BREAKER_OPEN_SECONDS", 30)
+	constant.ChannelBreakerHalfOpenRequests = GetEnvOrDefault("CHANNEL_BREAKER_HALF_OPEN_REQUESTS", 1)
+	// 渠道主动探测，仅在主节点运行，默认关闭
+	constant.ChannelProbeIntervalSeconds = GetEnvOrDefault("CHANNEL_PROBE_INTERVAL", 0)
+	constant.ChannelProbeConcurrency = GetEnvOrDefault("CHANNEL_PROBE_CONCURRENCY", 4)
+	constant.ChannelProbePrompt = GetEnvOrDefaultString("CHANNEL_PROBE_PROMPT", "hi")
+	constant.ChannelProbeEnableThreshold = GetEnvOrDefault("CHANNEL_PROBE_ENABLE_THRESHOLD", 3)
+	// 多 key 渠道 key 冷却
+	constant.ChannelKeyCooldownBaseSeconds = GetEnvOrDefault("CHANNEL_KEY_COOLDOWN_BASE", 10)
+	constant.ChannelKeyCooldownMaxSeconds = GetEnvOrDefault("CHANNEL_KEY_COOLDOWN_MAX", 600)
+	constant.ChannelKeyUsageWindowSeconds = GetEnvOrDefault("CHANNEL_KEY_USAGE_WINDOW", 60)
+	// 渠道并发限制的等待队列
+	constant.ChannelConcurrencyQueueSize = GetEnvOrDefault("CHANNEL_CONCURRENCY_QUEUE_SIZE", 50)
+	constant.ChannelConcurrencyWaitTimeoutSeconds = GetEnvOrDefault("CHANNEL_CONCURRENCY_WAIT_TIMEOUT", 10)
+	// 渠道上游预算
+	constant.ChannelBudgetSoftThreshold = GetEnvOrDefaultFloat("CHANNEL_BUDGET_SOFT_THRESHOLD", 0.2)
+	// 会话亲和
+	constant.ChannelAffinityEnabled = GetEnvOrDefaultBool("CHANNEL_AFFINITY_ENABLED", false)
+	constant.ChannelAffinityTTLSeconds = GetEnvOrDefault("CHANNEL_AFFINITY_TTL", 600)
+	constant.ChannelAffinityHeader = GetEnvOrDefaultString("CHANNEL_AFFINITY_HEADER", "X-Session-Id")
+	constant.ChannelAffinityPromptMessages = GetEnvOrDefault("CHANNEL_AFFINITY_PROMPT_MESSAGES", 1)
+	// 对冲请求
+	constant.ChannelHedgeGroups = splitAndTrim(GetEnvOrDefaultString("CHANNEL_HEDGE_GROUPS", ""))
+	constant.ChannelHedgeModels = splitAndTrim(GetEnvOrDefaultString("CHANNEL_HEDGE_MODELS", ""))
+	constant.ChannelHedgeDelayMs = GetEnvOrDefault("CHANNEL_HEDGE_DELAY_MS", 0)
+	// 流式请求首字超时
+	constant.StreamFirstTokenTimeout = GetEnvOrDefault("STREAM_FIRST_TOKEN_TIMEOUT", 0)
 
 	soraPatchStr := GetEnvOrDefaultString("TASK_PRICE_PATCH", "")
 	if soraPatchStr != "" {
@@ -136,3 +199,34 @@ func initConstantEnv() {
 		constant.TaskPricePatches = taskPricePatches
 	}
 }
+
+// parseAdminHmacSecrets 解析 caller1:secret1,caller2:secret2 格式的签名密钥
+func parseAdminHmacSecrets(str string) map[string]string {
+	secrets := make(map[string]string)
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		caller, secret, ok := strings.Cut(item, ":")
+		caller = strings.TrimSpace(caller)
+		secret = strings.TrimSpace(secret)
+		if !ok || caller == "" || secret == "" {
+			log.Println("WARNING: invalid ADMIN_HMAC_SECRETS item, expected caller:secret")
+			continue
+		}
+		secrets[caller] = secret
+	}
+	return secrets
+}
+
+// splitAndTrim 按逗号分隔并去掉空白和空项
+func splitAndTrim(str string) []string {
+	var items []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
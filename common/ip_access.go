@@ -0,0 +1,111 @@
+package common
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// IpAccessList IP 访问控制列表，条目为单个 IP 或 CIDR（IPv4/IPv6），以 ! 开头的条目为拒绝规则。
+// 命中拒绝规则时拒绝；存在允许规则时必须命中其中之一
+type IpAccessList struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// ParseIpAccessList 解析以换行或逗号分隔的 IP 列表，无效条目会被跳过并返回第一个错误
+func ParseIpAccessList(str string) (*IpAccessList, error) {
+	list := &IpAccessList{}
+	var firstErr error
+	entries := strings.FieldsFunc(str, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ','
+	})
+	for _, entry := range entries {
+		entry = strings.ReplaceAll(strings.TrimSpace(entry), " ", "")
+		if entry == "" {
+			continue
+		}
+		deny := strings.HasPrefix(entry, "!")
+		prefix, err := parseIpAccessEntry(strings.TrimPrefix(entry, "!"))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if deny {
+			list.Deny = append(list.Deny, prefix)
+		} else {
+			list.Allow = append(list.Allow, prefix)
+		}
+	}
+	return list, firstErr
+}
+
+// DenyAllIpAccessList 拒绝所有 IP 的列表，规则无法正确解析时使用
+func DenyAllIpAccessList() *IpAccessList {
+	return &IpAccessList{
+		Deny: []netip.Prefix{
+			netip.PrefixFrom(netip.IPv4Unspecified(), 0),
+			netip.PrefixFrom(netip.IPv6Unspecified(), 0),
+		},
+	}
+}
+
+func parseIpAccessEntry(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("无效的 CIDR: %s", entry)
+		}
+		addr := prefix.Addr()
+		if addr.Is4In6() && prefix.Bits() >= 96 {
+			return netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96).Masked(), nil
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := normalizeIp(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("无效的 IP: %s", entry)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// normalizeIp 去掉 IPv6 zone，并将 IPv4-mapped IPv6 地址转换为 IPv4
+func normalizeIp(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.WithZone("").Unmap(), nil
+}
+
+// IsEmpty 未配置任何规则
+func (l *IpAccessList) IsEmpty() bool {
+	return l == nil || (len(l.Allow) == 0 && len(l.Deny) == 0)
+}
+
+// IsAllowed 判断 IP 是否允许访问，无法解析的 IP 在配置了规则时一律拒绝
+func (l *IpAccessList) IsAllowed(ip string) bool {
+	if l.IsEmpty() {
+		return true
+	}
+	addr, err := normalizeIp(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range l.Deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(l.Allow) == 0 {
+		return true
+	}
+	for _, prefix := range l.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
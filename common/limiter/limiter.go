@@ -13,9 +13,13 @@ import (
 //go:embed lua/rate_limit.lua
 var rateLimitScript string
 
+//go:embed lua/rate_limit_all.lua
+var rateLimitAllScript string
+
 type RedisLimiter struct {
-	client         *redis.Client
-	limitScriptSHA string
+	client            *redis.Client
+	limitScriptSHA    string
+	limitAllScriptSHA string
 }
 
 var (
@@ -30,9 +34,14 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 		if err != nil {
 			common.SysLog(fmt.Sprintf("Failed to load rate limit script: %v", err))
 		}
+		limitAllSHA, err := r.ScriptLoad(ctx, rateLimitAllScript).Result()
+		if err != nil {
+			common.SysLog(fmt.Sprintf("Failed to load rate limit all script: %v", err))
+		}
 		instance = &RedisLimiter{
-			client:         r,
-			limitScriptSHA: limitSHA,
+			client:            r,
+			limitScriptSHA:    limitSHA,
+			limitAllScriptSHA: limitAllSHA,
 		}
 	})
 
@@ -40,6 +49,12 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 }
 
 func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (bool, error) {
+	allowed, _, err := rl.AllowWithRemaining(ctx, key, opts...)
+	return allowed, err
+}
+
+// AllowWithRemaining 执行限流并返回扣减后桶内剩余的令牌数
+func (rl *RedisLimiter) AllowWithRemaining(ctx context.Context, key string, opts ...Option) (bool, int64, error) {
 	// 默认配置
 	config := &Config{
 		Capacity:  10,
@@ -60,12 +75,49 @@ func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (
 		config.Requested,
 		config.Rate,
 		config.Capacity,
-	).Int()
+	).Int64Slice()
+
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit failed: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("rate limit failed: unexpected script result %v", result)
+	}
+	return result[0] == 1, result[1], nil
+}
+
+// BucketResult 单个令牌桶的限流结果，Enough 表示该桶令牌是否足够，Remaining 为桶内剩余令牌数
+type BucketResult struct {
+	Enough    bool
+	Remaining int64
+}
 
+// AllowAllWithRemaining 对多个令牌桶同时限流，只有全部桶的令牌都足够时才同时扣减，
+// 任一桶不足时不扣减任何桶
+func (rl *RedisLimiter) AllowAllWithRemaining(ctx context.Context, keys []string, configs []Config) (bool, []BucketResult, error) {
+	if len(keys) != len(configs) {
+		return false, nil, fmt.Errorf("rate limit failed: %d keys with %d configs", len(keys), len(configs))
+	}
+	args := make([]interface{}, 0, len(configs)*3)
+	for _, config := range configs {
+		args = append(args, config.Requested, config.Rate, config.Capacity)
+	}
+
+	result, err := rl.client.EvalSha(ctx, rl.limitAllScriptSHA, keys, args...).Int64Slice()
 	if err != nil {
-		return false, fmt.Errorf("rate limit failed: %w", err)
+		return false, nil, fmt.Errorf("rate limit failed: %w", err)
+	}
+	if len(result) != 1+2*len(keys) {
+		return false, nil, fmt.Errorf("rate limit failed: unexpected script result %v", result)
+	}
+	buckets := make([]BucketResult, len(keys))
+	for i := range buckets {
+		buckets[i] = BucketResult{
+			Enough:    result[1+2*i] == 1,
+			Remaining: result[2+2*i],
+		}
 	}
-	return result == 1, nil
+	return result[0] == 1, buckets, nil
 }
 
 // Config 配置选项模式
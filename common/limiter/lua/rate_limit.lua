@@ -3,6 +3,7 @@
 -- ARGV[1]: 请求令牌数 (通常为1)
 -- ARGV[2]: 令牌生成速率 (每秒)
 -- ARGV[3]: 桶容量
+-- 返回: {是否允许(1/0), 扣减后剩余令牌数}
 
 local key = KEYS[1]
 local requested = tonumber(ARGV[1])
@@ -41,4 +42,4 @@ end
 redis.call('HMSET', key, 'tokens', tokens, 'last_time', last_time)
 --redis.call('EXPIRE', key, math.ceil(capacity / rate) + 60) -- 适当延长过期时间
 
-return allowed and 1 or 0
\ No newline at end of file
+return {allowed and 1 or 0, math.floor(tokens)}
\ No newline at end of file
@@ -0,0 +1,47 @@
+-- 多个令牌桶同时限流：只有全部桶的令牌都足够时才同时扣减，任一桶不足时不扣减任何桶
+-- KEYS[i]: 第 i 个限流器唯一标识
+-- ARGV[3*i-2]: 第 i 个桶请求令牌数
+-- ARGV[3*i-1]: 第 i 个桶令牌生成速率 (每秒)
+-- ARGV[3*i]: 第 i 个桶容量
+-- 返回: {是否允许(1/0), 第 1 个桶是否足够(1/0), 第 1 个桶剩余令牌数, 第 2 个桶是否足够, ...}
+
+local now = redis.call('TIME')
+local nowInSeconds = tonumber(now[1])
+
+local buckets = {}
+local allowed = true
+for i, key in ipairs(KEYS) do
+    local requested = tonumber(ARGV[3 * i - 2])
+    local rate = tonumber(ARGV[3 * i - 1])
+    local capacity = tonumber(ARGV[3 * i])
+
+    local bucket = redis.call('HMGET', key, 'tokens', 'last_time')
+    local tokens = tonumber(bucket[1])
+    local last_time = tonumber(bucket[2])
+
+    -- 初始化桶（首次请求或过期），否则计算新增令牌
+    if not tokens or not last_time then
+        tokens = capacity
+    else
+        local elapsed = nowInSeconds - last_time
+        tokens = math.min(capacity, tokens + elapsed * rate)
+    end
+
+    local enough = tokens >= requested
+    if not enough then
+        allowed = false
+    end
+    buckets[i] = {tokens = tokens, requested = requested, enough = enough}
+end
+
+local result = {allowed and 1 or 0}
+for i, key in ipairs(KEYS) do
+    local bucket = buckets[i]
+    if allowed then
+        bucket.tokens = bucket.tokens - bucket.requested
+    end
+    redis.call('HMSET', key, 'tokens', bucket.tokens, 'last_time', nowInSeconds)
+    table.insert(result, bucket.enough and 1 or 0)
+    table.insert(result, math.floor(bucket.tokens))
+end
+return result
@@ -36,6 +36,15 @@ func (lc *LocalCache) Set(key string, value interface{}) {
 	lc.cache.Store(key, item)
 }
 
+// SetWithTTL 使用指定的过期时间设置缓存
+func (lc *LocalCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	item := LocalCacheItem{
+		Value:      value,
+		ExpireTime: time.Now().Add(ttl),
+	}
+	lc.cache.Store(key, item)
+}
+
 // Get 获取缓存，返回 value 和是否找到
 func (lc *LocalCache) Get(key string) (interface{}, bool) {
 	val, ok := lc.cache.Load(key)
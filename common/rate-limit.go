@@ -68,3 +68,65 @@ func (l *InMemoryRateLimiter) Request(key string, maxRequestNum int, duration in
 	}
 	return true
 }
+
+// RateLimitRequest 需要同时满足的一个滑动窗口，Duration 单位为秒
+type RateLimitRequest struct {
+	Key           string
+	MaxRequestNum int
+	Duration      int64
+}
+
+// RateLimitResult 单个窗口的限流结果，Remaining 为窗口内剩余次数，
+// ResetAfter 为距离最早一条记录移出窗口（即恢复一次额度）的秒数
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	ResetAfter int64
+}
+
+// RequestWithRemaining 与 Request 相同的滑动窗口限流，额外返回窗口内剩余次数
+// 以及距离最早一条记录移出窗口（即恢复一次额度）的秒数，duration 单位为秒
+func (l *InMemoryRateLimiter) RequestWithRemaining(key string, maxRequestNum int, duration int64) (bool, int, int64) {
+	_, results := l.RequestAllWithRemaining([]RateLimitRequest{{Key: key, MaxRequestNum: maxRequestNum, Duration: duration}})
+	return results[0].Allowed, results[0].Remaining, results[0].ResetAfter
+}
+
+// RequestAllWithRemaining 同时检查多个窗口，只有全部窗口都有剩余次数时才在每个窗口中记录本次请求，
+// 任一窗口超限时不消耗其他窗口的次数
+func (l *InMemoryRateLimiter) RequestAllWithRemaining(requests []RateLimitRequest) (bool, []RateLimitResult) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now().Unix()
+	queues := make([]*[]int64, len(requests))
+	results := make([]RateLimitResult, len(requests))
+	allowed := true
+	for i, request := range requests {
+		queue, ok := l.store[request.Key]
+		if !ok {
+			s := make([]int64, 0, request.MaxRequestNum)
+			queue = &s
+			l.store[request.Key] = queue
+		}
+		// 移除已经滑出窗口的记录
+		expired := 0
+		for expired < len(*queue) && now-(*queue)[expired] >= request.Duration {
+			expired++
+		}
+		*queue = (*queue)[expired:]
+		queues[i] = queue
+		results[i].Allowed = len(*queue) < request.MaxRequestNum
+		allowed = allowed && results[i].Allowed
+	}
+
+	for i, request := range requests {
+		queue := queues[i]
+		if allowed {
+			*queue = append(*queue, now)
+		}
+		results[i].Remaining = request.MaxRequestNum - len(*queue)
+		if len(*queue) > 0 {
+			results[i].ResetAfter = request.Duration - (now - (*queue)[0])
+		}
+	}
+	return allowed, results
+}
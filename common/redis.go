@@ -302,6 +302,43 @@ func RedisIncr(key string, delta int64) error {
 	return nil
 }
 
+// RedisGetInt64 读取整数值，键不存在时返回 0
+func RedisGetInt64(key string) (int64, error) {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis GET: key=%s", key))
+	}
+	ctx := context.Background()
+	val, err := RDB.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return val, err
+}
+
+// RedisIncrByExpireAt 原子增加计数并设置绝对过期时间（键不存在时会创建），返回增加后的值
+func RedisIncrByExpireAt(key string, delta int64, expireAt time.Time) (int64, error) {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis INCRBY: key=%s, delta=%d, expire_at=%v", key, delta, expireAt))
+	}
+	ctx := context.Background()
+	txn := RDB.TxPipeline()
+	incrCmd := txn.IncrBy(ctx, key, delta)
+	txn.ExpireAt(ctx, key, expireAt)
+	if _, err := txn.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incrCmd.Val(), nil
+}
+
+// RedisSetNX 键不存在时写入并返回 true，已存在时返回 false
+func RedisSetNX(key string, value string, expiration time.Duration) (bool, error) {
+	if DebugEnabled {
+		SysLog(fmt.Sprintf("Redis SETNX: key=%s, expiration=%v", key, expiration))
+	}
+	ctx := context.Background()
+	return RDB.SetNX(ctx, key, value, expiration).Result()
+}
+
 func RedisHIncrBy(key, field string, delta int64) error {
 	if DebugEnabled {
 		SysLog(fmt.Sprintf("Redis HINCRBY: key=%s, field=%s, delta=%d", key, field, delta))
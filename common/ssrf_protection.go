@@ -71,6 +71,11 @@ func isPrivateIP(ip net.IP) bool {
 	return false
 }
 
+// IsPrivateIP 检查IP是否为私有、回环、链路本地等内网地址
+func IsPrivateIP(ip net.IP) bool {
+	return isPrivateIP(ip)
+}
+
 // parsePortRanges 解析端口范围配置
 // 支持格式: "80", "443", "8000-9000"
 func parsePortRanges(portConfigs []string) ([]int, error) {
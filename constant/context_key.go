@@ -17,6 +17,10 @@ const (
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenDailySpendLimit   ContextKey = "token_daily_spending_limit"
+	ContextKeyTokenMonthlySpendLimit ContextKey = "token_monthly_spending_limit"
+	ContextKeyChildTokenId           ContextKey = "child_token_id"
+	ContextKeyChildTokenSpendLimit   ContextKey = "child_token_spending_limit"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -34,8 +38,15 @@ const (
 	ContextKeyChannelStatusCodeMapping ContextKey = "status_code_mapping"
 	ContextKeyChannelIsMultiKey        ContextKey = "channel_is_multi_key"
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
+	ContextKeyChannelMultiKeyMode      ContextKey = "channel_multi_key_mode"
 	ContextKeyChannelKey               ContextKey = "channel_key"
 
+	/* channel affinity related keys */
+	ContextKeyChannelAffinityKey    ContextKey = "channel_affinity_key"
+	ContextKeyChannelAffinitySource ContextKey = "channel_affinity_source"
+	ContextKeyChannelAffinityTarget ContextKey = "channel_affinity_target"
+	ContextKeyChannelAffinityHit    ContextKey = "channel_affinity_hit"
+
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
 	ContextKeyUserSetting ContextKey = "user_setting"
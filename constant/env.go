@@ -14,5 +14,116 @@ var NotificationLimitDurationMinute int
 var GenerateDefaultToken bool
 var ErrorLogEnabled bool
 
+// 兼容模式：按 key_hash 查不到令牌时回退到明文 key 查询，并回填 key_hash 等字段
+var TokenLegacyKeyLookup bool
+
+// 令牌 key 轮换后旧 key 的默认宽限期（秒）
+var TokenRotationGracePeriodSeconds int
+
+// 令牌每日/每月消费额度按该时区的自然日、自然月重置，如 Asia/Shanghai
+var TokenSpendingTimezone string
+
+// 管理 API 静态密钥，通过 Authorization: Bearer <secret> 传入
+var AdminSecret string
+
+// 管理 API 签名密钥，调用方标识 -> 密钥，如 python-backend:xxxx
+var AdminHmacSecrets map[string]string
+
+// 管理 API 签名请求允许的时间偏差（秒），nonce 在 2 倍偏差时间内不可重复
+var AdminSignatureMaxSkewSeconds int
+
+// 受信任的反向代理（IP 或 CIDR），仅信任来自这些地址的 X-Forwarded-For 等请求头；nil 表示沿用 gin 默认（信任所有）
+var TrustedProxies []string
+
+// 读取客户端真实 IP 的请求头，按顺序查找
+var RemoteIPHeaders []string
+
+// 令牌生命周期巡检间隔（秒），将过期、耗尽的令牌更新状态并清除缓存
+var TokenLifecycleSweepInterval int
+
+// 令牌过期前多少天发送提醒，0 表示不提醒
+var TokenExpiryNotifyDays int
+
+// 子令牌（JWT）签名密钥，为空时使用 CRYPTO_SECRET，多节点部署时各节点需一致
+var ChildTokenSecret string
+
+// 子令牌最长有效期（秒）
+var ChildTokenMaxTTLSeconds int
+
+// 渠道健康度加权：按成功率和首字延迟的 EWMA 调整同一优先级内渠道的有效权重
+var ChannelHealthEnabled bool
+
+// EWMA 平滑系数，越大越偏重最近的请求
+var ChannelHealthEwmaAlpha float64
+
+// 健康度最差时有效权重的最低比例，保证异常渠道仍有少量流量用于恢复
+var ChannelHealthMinWeightFactor float64
+
+// 健康度的半衰期（秒），长时间没有新请求时逐渐恢复为健康
+var ChannelHealthHalfLifeSeconds int
+
+// 启用 Redis 时从 Redis 同步各节点共享健康度的间隔（秒）
+var ChannelHealthSyncIntervalSeconds int
+
+// 渠道熔断：同一渠道+模型连续失败次数达到阈值后熔断
+var ChannelBreakerEnabled bool
+var ChannelBreakerFailureThreshold int
+
+// 熔断持续时间（秒），之后进入半开状态放行试探请求
+var ChannelBreakerOpenSeconds int
+
+// 半开状态下同时放行的试探请求数
+var ChannelBreakerHalfOpenRequests int
+
+// 渠道主动探测间隔（秒），0 表示不探测
+var ChannelProbeIntervalSeconds int
+
+// 同时探测的渠道 key 数
+var ChannelProbeConcurrency int
+
+// 探测请求使用的提示词
+var ChannelProbePrompt string
+
+// 自动禁用的渠道（或 key）连续探测成功多少次后自动启用
+var ChannelProbeEnableThreshold int
+
+// 多 key 渠道的 key 遇到 429、额度不足时的冷却时间（秒），无 Retry-After 时从基础时间开始指数退避
+var ChannelKeyCooldownBaseSeconds int
+var ChannelKeyCooldownMaxSeconds int
+
+// 多 key 渠道 usage_balanced 模式统计用量的窗口（秒）
+var ChannelKeyUsageWindowSeconds int
+
+// 渠道并发已满时每个渠道的最大排队数和最长等待时间（秒）
+var ChannelConcurrencyQueueSize int
+var ChannelConcurrencyWaitTimeoutSeconds int
+
+// 渠道剩余上游预算（RPM、TPM）低于该比例时开始降低选择权重
+var ChannelBudgetSoftThreshold float64
+
+// 是否启用会话亲和，同一会话的请求优先路由到上次成功的渠道和 key
+var ChannelAffinityEnabled bool
+
+// 会话亲和映射的过期时间（秒），每次请求成功后刷新
+var ChannelAffinityTTLSeconds int
+
+// 客户端传递会话 id 的请求头
+var ChannelAffinityHeader string
+
+// 未传递会话 id 和 user 时，计算提示词指纹使用的消息条数（不含 system）
+var ChannelAffinityPromptMessages int
+
+// 启用对冲请求的分组
+var ChannelHedgeGroups []string
+
+// 启用对冲请求的模型
+var ChannelHedgeModels []string
+
+// 发出对冲请求前的等待时间（毫秒），0 表示使用近期请求耗时的 p95
+var ChannelHedgeDelayMs int
+
+// 流式请求等待首个数据的超时时间（秒），0 表示使用 STREAMING_TIMEOUT
+var StreamFirstTokenTimeout int
+
 // temporary variable for sora patch, will be removed in future
 var TaskPricePatches []string
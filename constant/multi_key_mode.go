@@ -5,4 +5,8 @@ type MultiKeyMode string
 const (
 	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
 	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+	// 最少并发：选择进行中请求数最少的 key，适合长流式请求较多的渠道
+	MultiKeyModeLeastInflight MultiKeyMode = "least_inflight"
+	// 用量均衡：选择当前统计窗口内消费额度最少的 key
+	MultiKeyModeUsageBalanced MultiKeyMode = "usage_balanced"
 )
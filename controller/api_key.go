@@ -2,6 +2,7 @@ package controller
 
 import (
 	"net/http"
+	"time"
 
 	"relay-gateway/common"
 	"relay-gateway/model"
@@ -157,6 +158,77 @@ func BatchDeleteTokenCache(c *gin.Context) {
 	})
 }
 
+// ========== Token 轮换 ==========
+
+// RotateTokenKeyRequest 轮换 Token key 请求结构
+type RotateTokenKeyRequest struct {
+	Id                 string `json:"id" binding:"required"` // Token ID
+	GracePeriodSeconds *int64 `json:"grace_period_seconds"`  // 旧 key 宽限期（秒），为空时使用 TOKEN_ROTATION_GRACE_PERIOD，0 表示立即失效
+}
+
+// RotateTokenKeyData 轮换结果
+type RotateTokenKeyData struct {
+	Id                   string     `json:"id"`
+	Key                  string     `json:"key"` // 新 key，仅在此返回一次
+	DisplayKey           string     `json:"display_key"`
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at"`
+}
+
+// RotateTokenKeyResponse 轮换 Token key 响应结构
+type RotateTokenKeyResponse struct {
+	Success bool                `json:"success"`
+	Message string              `json:"message"`
+	Data    *RotateTokenKeyData `json:"data,omitempty"`
+}
+
+// RotateTokenKey 为 Token 生成新的 key，id、额度和各项限制保持不变，旧 key 在宽限期内仍可使用
+// POST /api/admin/token/rotate
+func RotateTokenKey(c *gin.Context) {
+	var req RotateTokenKeyRequest
+
+	// 解析请求参数
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, RotateTokenKeyResponse{
+			Success: false,
+			Message: "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	gracePeriod := model.GetTokenRotationGracePeriod()
+	if req.GracePeriodSeconds != nil {
+		if *req.GracePeriodSeconds < 0 {
+			c.JSON(http.StatusBadRequest, RotateTokenKeyResponse{
+				Success: false,
+				Message: "grace_period_seconds 不能为负数",
+			})
+			return
+		}
+		gracePeriod = time.Duration(*req.GracePeriodSeconds) * time.Second
+	}
+
+	newKey, token, err := model.RotateTokenEnhancedKey(req.Id, gracePeriod)
+	if err != nil {
+		common.SysLog("Failed to rotate token key for id: " + req.Id + ", error: " + err.Error())
+		c.JSON(http.StatusInternalServerError, RotateTokenKeyResponse{
+			Success: false,
+			Message: "轮换失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, RotateTokenKeyResponse{
+		Success: true,
+		Message: "轮换成功",
+		Data: &RotateTokenKeyData{
+			Id:                   token.Id,
+			Key:                  "sk-" + newKey,
+			DisplayKey:           token.DisplayKey,
+			PreviousKeyExpiresAt: token.PreviousKeyExpiresAt,
+		},
+	})
+}
+
 // ========== User 缓存管理 ==========
 
 // DeleteUserCacheRequest 删除 User 缓存请求结构
@@ -194,15 +266,9 @@ func DeleteUserCache(c *gin.Context) {
 		return
 	}
 
-	// 调用删除缓存函数（会同时删除 Redis 和本地缓存）
-	// 使用 model 包中未导出的函数，需要通过导出的函数访问
-	// 这里我们直接删除
-	model.LocalCacheDeleteUser(req.UserId)
-
-	// 同时删除 Redis 缓存
-	cacheKey := "user:" + req.UserId
-	err := common.RedisDelKey(cacheKey)
-	if err != nil && common.RedisEnabled {
+	// 删除 Redis 缓存和本地缓存，并通知其他节点删除本地缓存
+	err := model.CacheDeleteUser(req.UserId)
+	if err != nil {
 		common.SysLog("Failed to delete user Redis cache for userId: " + req.UserId + ", error: " + err.Error())
 		c.JSON(http.StatusInternalServerError, DeleteUserCacheResponse{
 			Success: false,
@@ -269,13 +335,9 @@ func BatchDeleteUserCache(c *gin.Context) {
 			continue
 		}
 
-		// 删除本地缓存
-		model.LocalCacheDeleteUser(userId)
-
-		// 删除 Redis 缓存
-		cacheKey := "user:" + userId
-		err := common.RedisDelKey(cacheKey)
-		if err != nil && common.RedisEnabled {
+		// 删除 Redis 缓存和本地缓存，并通知其他节点删除本地缓存
+		err := model.CacheDeleteUser(userId)
+		if err != nil {
 			failedIds[userId] = err.Error()
 			common.SysLog("Failed to delete user cache for userId: " + userId + ", error: " + err.Error())
 		} else {
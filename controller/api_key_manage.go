@@ -0,0 +1,394 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/model"
+	relayconstant "relay-gateway/relay/constant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== Token 管理 ==========
+
+// 新建令牌未指定时使用的默认限制，与 t_api_keys 列默认值一致
+const (
+	defaultTokenRateLimitPerMinute        = 60
+	defaultTokenRateLimitPerHour          = 1000
+	defaultTokenRateLimitPerDay           = 10000
+	defaultTokenDailySpendingLimitCents   = 1000
+	defaultTokenMonthlySpendingLimitCents = 10000
+)
+
+// TokenManageRequest 创建/更新 Token 请求结构，未传的字段保持不变（创建时使用默认值）
+type TokenManageRequest struct {
+	UserId                    *string `json:"user_id"`
+	Name                      *string `json:"name"`
+	Description               *string `json:"description"`
+	ExpiresAt                 *int64  `json:"expires_at"` // Unix 时间戳（秒），-1 表示永不过期
+	RemainQuota               *int    `json:"remain_quota"`
+	UnlimitedQuota            *bool   `json:"unlimited_quota"`
+	RateLimitPerMinute        *int    `json:"rate_limit_per_minute"` // 0 表示不限制
+	RateLimitPerHour          *int    `json:"rate_limit_per_hour"`
+	RateLimitPerDay           *int    `json:"rate_limit_per_day"`
+	DailySpendingLimitCents   *int    `json:"daily_spending_limit_cents"` // 0 表示不限制
+	MonthlySpendingLimitCents *int    `json:"monthly_spending_limit_cents"`
+	ModelLimitsEnabled        *bool   `json:"model_limits_enabled"`
+	ModelLimits               *string `json:"model_limits"` // 逗号分隔
+	AllowIps                  *string `json:"allow_ips"`    // IP 或 CIDR，换行或逗号分隔，! 开头为拒绝规则
+	Group                     *string `json:"group"`
+	Scopes                    *string `json:"scopes"` // 接口范围，逗号分隔，为空表示不限制
+}
+
+// TokenManageResponse Token 管理响应结构
+type TokenManageResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// CreateTokenData 创建结果，key 仅在此返回一次
+type CreateTokenData struct {
+	*model.TokenEnhanced
+	Key string `json:"key"`
+}
+
+func (req *TokenManageRequest) validate() error {
+	if req.Name != nil && (*req.Name == "" || len(*req.Name) > 100) {
+		return errors.New("name 长度需在 1-100 之间")
+	}
+	for name, value := range map[string]*int{
+		"remain_quota":                 req.RemainQuota,
+		"rate_limit_per_minute":        req.RateLimitPerMinute,
+		"rate_limit_per_hour":          req.RateLimitPerHour,
+		"rate_limit_per_day":           req.RateLimitPerDay,
+		"daily_spending_limit_cents":   req.DailySpendingLimitCents,
+		"monthly_spending_limit_cents": req.MonthlySpendingLimitCents,
+	} {
+		if value != nil && *value < 0 {
+			return errors.New(name + " 不能为负数")
+		}
+	}
+	if req.ExpiresAt != nil && *req.ExpiresAt != -1 && *req.ExpiresAt <= time.Now().Unix() {
+		return errors.New("expires_at 必须晚于当前时间，或为 -1 表示永不过期")
+	}
+	if req.ModelLimits != nil && len(*req.ModelLimits) > 1024 {
+		return errors.New("model_limits 过长")
+	}
+	if req.Scopes != nil {
+		for _, scope := range strings.Split(*req.Scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" && !relayconstant.IsValidEndpointScope(scope) {
+				return errors.New("未知的接口范围: " + scope)
+			}
+		}
+	}
+	if req.AllowIps != nil {
+		if _, err := common.ParseIpAccessList(*req.AllowIps); err != nil {
+			return errors.New("allow_ips 格式错误: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (req *TokenManageRequest) expiresAt() *time.Time {
+	if req.ExpiresAt == nil || *req.ExpiresAt == -1 {
+		return nil
+	}
+	expiresAt := time.Unix(*req.ExpiresAt, 0)
+	return &expiresAt
+}
+
+// toToken 创建时使用，未传的字段取默认值
+func (req *TokenManageRequest) toToken() *model.TokenEnhanced {
+	token := &model.TokenEnhanced{
+		RateLimitPerMinute:        defaultTokenRateLimitPerMinute,
+		RateLimitPerHour:          defaultTokenRateLimitPerHour,
+		RateLimitPerDay:           defaultTokenRateLimitPerDay,
+		DailySpendingLimitCents:   defaultTokenDailySpendingLimitCents,
+		MonthlySpendingLimitCents: defaultTokenMonthlySpendingLimitCents,
+	}
+	if req.UserId != nil {
+		token.UserId = *req.UserId
+	}
+	if req.Name != nil {
+		token.Name = *req.Name
+	}
+	token.Description = req.Description
+	token.ExpiresAt = req.expiresAt()
+	if req.RemainQuota != nil {
+		token.RemainQuota = *req.RemainQuota
+	}
+	if req.UnlimitedQuota != nil {
+		token.UnlimitedQuota = *req.UnlimitedQuota
+	}
+	if req.RateLimitPerMinute != nil {
+		token.RateLimitPerMinute = *req.RateLimitPerMinute
+	}
+	if req.RateLimitPerHour != nil {
+		token.RateLimitPerHour = *req.RateLimitPerHour
+	}
+	if req.RateLimitPerDay != nil {
+		token.RateLimitPerDay = *req.RateLimitPerDay
+	}
+	if req.DailySpendingLimitCents != nil {
+		token.DailySpendingLimitCents = *req.DailySpendingLimitCents
+	}
+	if req.MonthlySpendingLimitCents != nil {
+		token.MonthlySpendingLimitCents = *req.MonthlySpendingLimitCents
+	}
+	if req.ModelLimitsEnabled != nil {
+		token.ModelLimitsEnabled = *req.ModelLimitsEnabled
+	}
+	if req.ModelLimits != nil {
+		token.ModelLimits = *req.ModelLimits
+	}
+	allowIps := ""
+	if req.AllowIps != nil {
+		allowIps = *req.AllowIps
+	}
+	token.AllowIps = &allowIps
+	if req.Group != nil {
+		token.Group = *req.Group
+	}
+	if req.Scopes != nil {
+		token.Scopes = *req.Scopes
+	}
+	return token
+}
+
+// toUpdates 更新时使用，只包含请求中传入的字段
+func (req *TokenManageRequest) toUpdates() map[string]interface{} {
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.ExpiresAt != nil {
+		updates["expires_at"] = req.expiresAt()
+	}
+	if req.RemainQuota != nil {
+		updates["remain_quota"] = *req.RemainQuota
+	}
+	if req.UnlimitedQuota != nil {
+		updates["unlimited_quota"] = *req.UnlimitedQuota
+	}
+	if req.RateLimitPerMinute != nil {
+		updates["rate_limit_per_minute"] = *req.RateLimitPerMinute
+	}
+	if req.RateLimitPerHour != nil {
+		updates["rate_limit_per_hour"] = *req.RateLimitPerHour
+	}
+	if req.RateLimitPerDay != nil {
+		updates["rate_limit_per_day"] = *req.RateLimitPerDay
+	}
+	if req.DailySpendingLimitCents != nil {
+		updates["daily_spending_limit_cents"] = *req.DailySpendingLimitCents
+	}
+	if req.MonthlySpendingLimitCents != nil {
+		updates["monthly_spending_limit_cents"] = *req.MonthlySpendingLimitCents
+	}
+	if req.ModelLimitsEnabled != nil {
+		updates["model_limits_enabled"] = *req.ModelLimitsEnabled
+	}
+	if req.ModelLimits != nil {
+		updates["model_limits"] = *req.ModelLimits
+	}
+	if req.AllowIps != nil {
+		updates["allow_ips"] = *req.AllowIps
+	}
+	if req.Group != nil {
+		updates["group"] = *req.Group
+	}
+	if req.Scopes != nil {
+		updates["scopes"] = *req.Scopes
+	}
+	return updates
+}
+
+func tokenManageError(c *gin.Context, err error, action string) {
+	statusCode := http.StatusInternalServerError
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		statusCode = http.StatusNotFound
+		err = errors.New("令牌不存在")
+	} else if errors.Is(err, model.ErrTokenEnhancedExpired) || errors.Is(err, model.ErrTokenEnhancedExhausted) {
+		statusCode = http.StatusBadRequest
+	} else {
+		common.SysLog("Failed to " + action + " token, error: " + err.Error())
+	}
+	c.JSON(statusCode, TokenManageResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// CreateToken 创建 Token，key 按 KeyPrefix/DisplayKey 规则生成，仅保存哈希
+// POST /api/admin/token
+func CreateToken(c *gin.Context) {
+	var req TokenManageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.UserId == nil || *req.UserId == "" || req.Name == nil {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: "user_id 和 name 不能为空",
+		})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	token := req.toToken()
+	key, err := model.CreateTokenEnhanced(token)
+	if err != nil {
+		tokenManageError(c, err, "create")
+		return
+	}
+	token.Clean()
+	c.JSON(http.StatusOK, TokenManageResponse{
+		Success: true,
+		Message: "创建成功",
+		Data: CreateTokenData{
+			TokenEnhanced: token,
+			Key:           "sk-" + key,
+		},
+	})
+}
+
+// ListTokens 分页查询 Token，支持 user_id、keyword（名称/key 前缀/展示 key）、status、group 过滤
+// GET /api/admin/token?p=1&page_size=10
+func ListTokens(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	status, _ := strconv.Atoi(c.Query("status"))
+	tokens, total, err := model.SearchTokensEnhanced(model.TokenEnhancedSearchParams{
+		UserId:  c.Query("user_id"),
+		Keyword: c.Query("keyword"),
+		Status:  status,
+		Group:   c.Query("group"),
+	}, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		tokenManageError(c, err, "list")
+		return
+	}
+	for _, token := range tokens {
+		token.Clean()
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(tokens)
+	c.JSON(http.StatusOK, TokenManageResponse{
+		Success: true,
+		Message: "",
+		Data:    pageInfo,
+	})
+}
+
+// GetToken 查询单个 Token
+// GET /api/admin/token/:id
+func GetToken(c *gin.Context) {
+	token, err := model.GetTokenEnhancedById(c.Param("id"))
+	if err != nil {
+		tokenManageError(c, err, "get")
+		return
+	}
+	token.Clean()
+	c.JSON(http.StatusOK, TokenManageResponse{
+		Success: true,
+		Message: "",
+		Data:    token,
+	})
+}
+
+// UpdateToken 更新 Token 的限制、模型限制、IP 白名单、分组、过期时间等，只更新传入的字段
+// PUT /api/admin/token/:id
+func UpdateToken(c *gin.Context) {
+	var req TokenManageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.UserId != nil {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: "不支持修改 user_id",
+		})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	token, err := model.UpdateTokenEnhancedById(c.Param("id"), req.toUpdates())
+	if err != nil {
+		tokenManageError(c, err, "update")
+		return
+	}
+	token.Clean()
+	c.JSON(http.StatusOK, TokenManageResponse{
+		Success: true,
+		Message: "更新成功",
+		Data:    token,
+	})
+}
+
+// EnableToken 启用 Token
+// POST /api/admin/token/:id/enable
+func EnableToken(c *gin.Context) {
+	setTokenStatus(c, common.TokenStatusEnabled)
+}
+
+// DisableToken 禁用 Token
+// POST /api/admin/token/:id/disable
+func DisableToken(c *gin.Context) {
+	setTokenStatus(c, common.TokenStatusDisabled)
+}
+
+func setTokenStatus(c *gin.Context, status int) {
+	token, err := model.SetTokenEnhancedStatus(c.Param("id"), status)
+	if err != nil {
+		tokenManageError(c, err, "update status of")
+		return
+	}
+	token.Clean()
+	c.JSON(http.StatusOK, TokenManageResponse{
+		Success: true,
+		Message: "状态更新成功",
+		Data:    token,
+	})
+}
+
+// DeleteToken 软删除 Token
+// DELETE /api/admin/token/:id
+func DeleteToken(c *gin.Context) {
+	if err := model.DeleteTokenEnhancedById(c.Param("id")); err != nil {
+		tokenManageError(c, err, "delete")
+		return
+	}
+	c.JSON(http.StatusOK, TokenManageResponse{
+		Success: true,
+		Message: "删除成功",
+	})
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"net/http"
+
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvalidateCacheRequest 缓存失效请求结构
+type InvalidateCacheRequest struct {
+	Type string `json:"type" binding:"required"` // token、token_id、user、channel、option、pricing
+	Key  string `json:"key"`                     // token 为令牌 key 的 HMAC，token_id 为令牌 id，user 为用户 id，其余类型可为空
+}
+
+// InvalidateCache 清除本节点的缓存并通过 Redis 通知所有节点
+// 用于外部系统直接修改数据库中的渠道、配置、定价等数据后立即生效
+// POST /api/admin/cache/invalidate
+func InvalidateCache(c *gin.Context) {
+	var req InvalidateCacheRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+			Success: false,
+			Message: "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if !model.IsCacheInvalidationType(req.Type) {
+		c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+			Success: false,
+			Message: "不支持的缓存类型: " + req.Type,
+		})
+		return
+	}
+	switch req.Type {
+	case model.CacheInvalidationToken, model.CacheInvalidationTokenId, model.CacheInvalidationUser:
+		if req.Key == "" {
+			c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+				Success: false,
+				Message: "key 不能为空",
+			})
+			return
+		}
+	}
+
+	// 令牌、用户缓存需要先删除 Redis 中的副本，否则各节点会重新读取到旧值
+	var err error
+	switch req.Type {
+	case model.CacheInvalidationToken:
+		err = model.CacheDeleteTokenEnhancedByHash(req.Key)
+	case model.CacheInvalidationTokenId:
+		err = model.CacheDeleteTokenEnhancedById(req.Key)
+	case model.CacheInvalidationUser:
+		err = model.CacheDeleteUser(req.Key)
+	default:
+		model.InvalidateCache(req.Type, req.Key)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ChannelAdminResponse{
+			Success: false,
+			Message: "清除缓存失败: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "缓存已失效",
+	})
+}
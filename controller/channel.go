@@ -0,0 +1,483 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"relay-gateway/common"
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ========== 渠道管理 ==========
+
+// 渠道写操作均在同一事务中维护 t_abilities，成功后刷新本节点渠道缓存并通知其他节点。响应中不返回渠道 key
+
+// UpdateChannelRequest 更新渠道请求结构，channel_info 未传时保持不变，key 状态只能通过启用/禁用 key 的接口修改
+type UpdateChannelRequest struct {
+	model.Channel
+	ChannelInfo *model.ChannelInfo `json:"channel_info"`
+}
+
+// ChannelIdsRequest 按 id 批量操作渠道的请求结构
+type ChannelIdsRequest struct {
+	Ids []string `json:"ids" binding:"required"`
+}
+
+// ChannelTagRequest 按标签启用/禁用渠道的请求结构
+type ChannelTagRequest struct {
+	Tag string `json:"tag" binding:"required"`
+}
+
+// EditChannelTagRequest 按标签批量编辑渠道的请求结构，未传或为空的字段保持不变
+type EditChannelTagRequest struct {
+	Tag            string  `json:"tag" binding:"required"`
+	NewTag         *string `json:"new_tag"`
+	ModelMapping   *string `json:"model_mapping"`
+	Models         *string `json:"models"`
+	Group          *string `json:"group"`
+	Priority       *int64  `json:"priority"`
+	Weight         *uint   `json:"weight"`
+	ParamOverride  *string `json:"param_override"`
+	HeaderOverride *string `json:"header_override"`
+}
+
+// BatchSetChannelTagRequest 批量设置渠道标签的请求结构，tag 为 null 时清除标签
+type BatchSetChannelTagRequest struct {
+	Ids []string `json:"ids" binding:"required"`
+	Tag *string  `json:"tag"`
+}
+
+// ChannelKeyStatusRequest 禁用多 key 渠道中 key 的请求结构
+type ChannelKeyStatusRequest struct {
+	Reason string `json:"reason"`
+}
+
+// FixChannelAbilitiesData 重建能力表的结果
+type FixChannelAbilitiesData struct {
+	Success int `json:"success"`
+	Fails   int `json:"fails"`
+}
+
+func channelManageError(c *gin.Context, err error, action string) {
+	statusCode := http.StatusInternalServerError
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		statusCode = http.StatusNotFound
+		err = errors.New("渠道不存在")
+	} else {
+		common.SysLog("Failed to " + action + " channel, error: " + err.Error())
+	}
+	c.JSON(statusCode, ChannelAdminResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+func channelBadRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+		Success: false,
+		Message: message,
+	})
+}
+
+// reloadChannelCache 刷新本节点渠道缓存并通知其他节点
+func reloadChannelCache(channelId string) {
+	model.InvalidateCache(model.CacheInvalidationChannel, channelId)
+}
+
+// prepareNewChannel 校验新建渠道并补全默认值
+func prepareNewChannel(channel *model.Channel) error {
+	channel.Name = strings.TrimSpace(channel.Name)
+	if channel.Name == "" || channel.Key == "" || channel.Models == "" {
+		return errors.New("name、key、models 不能为空")
+	}
+	if channel.Group == "" {
+		channel.Group = "default"
+	}
+	if channel.Status == 0 {
+		channel.Status = common.ChannelStatusEnabled
+	}
+	// 多 key 渠道按 key 列表计算数量，新渠道的 key 均为启用状态
+	if channel.ChannelInfo.IsMultiKey {
+		channel.ChannelInfo.MultiKeySize = len(channel.GetKeys())
+		channel.ChannelInfo.MultiKeyStatusList = nil
+		channel.ChannelInfo.MultiKeyDisabledReason = nil
+		channel.ChannelInfo.MultiKeyDisabledTime = nil
+		channel.ChannelInfo.MultiKeyPollingIndex = 0
+	}
+	return channel.ValidateSettings()
+}
+
+// ListChannels 分页查询渠道，id_sort=true 时按 id 排序，否则按优先级排序
+// GET /api/admin/channel?p=1&page_size=10
+func ListChannels(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	idSort, _ := strconv.ParseBool(c.Query("id_sort"))
+	channels, err := model.GetAllChannels(pageInfo.GetStartIdx(), pageInfo.GetPageSize(), false, idSort)
+	if err != nil {
+		channelManageError(c, err, "list")
+		return
+	}
+	total, err := model.CountAllChannels()
+	if err != nil {
+		channelManageError(c, err, "count")
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(channels)
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "",
+		Data:    pageInfo,
+	})
+}
+
+// SearchChannels 按关键字（id/名称/key/base_url）、分组、模型搜索渠道
+// GET /api/admin/channel/search?keyword=&group=&model=&id_sort=
+func SearchChannels(c *gin.Context) {
+	idSort, _ := strconv.ParseBool(c.Query("id_sort"))
+	channels, err := model.SearchChannels(c.Query("keyword"), c.Query("group"), c.Query("model"), idSort)
+	if err != nil {
+		channelManageError(c, err, "search")
+		return
+	}
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "",
+		Data:    channels,
+	})
+}
+
+// GetChannel 查询单个渠道
+// GET /api/admin/channel/:id
+func GetChannel(c *gin.Context) {
+	channel, err := model.GetChannelById(c.Param("id"), false)
+	if err != nil {
+		channelManageError(c, err, "get")
+		return
+	}
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "",
+		Data:    channel,
+	})
+}
+
+// CreateChannel 创建渠道，id 为空时自动生成，group 为空时使用 default
+// POST /api/admin/channel
+func CreateChannel(c *gin.Context) {
+	var channel model.Channel
+	if err := c.ShouldBindJSON(&channel); err != nil {
+		channelBadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	if err := prepareNewChannel(&channel); err != nil {
+		channelBadRequest(c, err.Error())
+		return
+	}
+	if err := channel.Insert(); err != nil {
+		channelManageError(c, err, "create")
+		return
+	}
+	reloadChannelCache(channel.Id)
+	channel.Key = ""
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "创建成功",
+		Data:    &channel,
+	})
+}
+
+// BatchCreateChannels 批量创建渠道，任一渠道校验或写入失败时全部不创建
+// POST /api/admin/channel/batch
+func BatchCreateChannels(c *gin.Context) {
+	var channels []model.Channel
+	if err := c.ShouldBindJSON(&channels); err != nil {
+		channelBadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	if len(channels) == 0 {
+		channelBadRequest(c, "渠道列表不能为空")
+		return
+	}
+	for i := range channels {
+		if err := prepareNewChannel(&channels[i]); err != nil {
+			channelBadRequest(c, fmt.Sprintf("第 %d 个渠道: %s", i+1, err.Error()))
+			return
+		}
+	}
+	if err := model.BatchInsertChannels(channels); err != nil {
+		channelManageError(c, err, "batch create")
+		return
+	}
+	reloadChannelCache("")
+	ids := make([]string, len(channels))
+	for i := range channels {
+		ids[i] = channels[i].Id
+	}
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "创建成功",
+		Data:    ids,
+	})
+}
+
+// UpdateChannel 更新渠道，未传或为空的字段保持不变；channel_info 中只有 is_multi_key 和 multi_key_mode 可修改
+// PUT /api/admin/channel/:id
+func UpdateChannel(c *gin.Context) {
+	var req UpdateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		channelBadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	existing, err := model.GetChannelById(c.Param("id"), false)
+	if err != nil {
+		channelManageError(c, err, "get")
+		return
+	}
+	channel := req.Channel
+	channel.Id = existing.Id
+	// 只允许修改多 key 开关和轮询方式，key 数量由 Update 按 key 列表重新计算
+	channel.ChannelInfo = existing.ChannelInfo
+	if req.ChannelInfo != nil {
+		channel.ChannelInfo.IsMultiKey = req.ChannelInfo.IsMultiKey
+		channel.ChannelInfo.MultiKeyMode = req.ChannelInfo.MultiKeyMode
+	}
+	// 更新 key 后下标可能变化，key 状态重置为全部启用
+	if channel.Key != "" {
+		channel.ChannelInfo.MultiKeyStatusList = nil
+		channel.ChannelInfo.MultiKeyDisabledReason = nil
+		channel.ChannelInfo.MultiKeyDisabledTime = nil
+		channel.ChannelInfo.MultiKeyPollingIndex = 0
+	}
+	if err := channel.ValidateSettings(); err != nil {
+		channelBadRequest(c, err.Error())
+		return
+	}
+	if err := channel.Update(); err != nil {
+		channelManageError(c, err, "update")
+		return
+	}
+	reloadChannelCache(channel.Id)
+	channel.Key = ""
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "更新成功",
+		Data:    &channel,
+	})
+}
+
+// DeleteChannel 删除渠道及其能力
+// DELETE /api/admin/channel/:id
+func DeleteChannel(c *gin.Context) {
+	channel, err := model.GetChannelById(c.Param("id"), false)
+	if err != nil {
+		channelManageError(c, err, "get")
+		return
+	}
+	if err := channel.Delete(); err != nil {
+		channelManageError(c, err, "delete")
+		return
+	}
+	reloadChannelCache(channel.Id)
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "删除成功",
+	})
+}
+
+// BatchDeleteChannels 批量删除渠道及其能力
+// POST /api/admin/channel/batch-delete
+func BatchDeleteChannels(c *gin.Context) {
+	var req ChannelIdsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		channelBadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	if len(req.Ids) == 0 {
+		channelBadRequest(c, "ids 不能为空")
+		return
+	}
+	if err := model.BatchDeleteChannels(req.Ids); err != nil {
+		channelManageError(c, err, "batch delete")
+		return
+	}
+	reloadChannelCache("")
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "删除成功",
+		Data:    len(req.Ids),
+	})
+}
+
+// EnableChannelsByTag 启用标签下的所有渠道
+// POST /api/admin/channel/tag/enable
+func EnableChannelsByTag(c *gin.Context) {
+	setChannelStatusByTag(c, true)
+}
+
+// DisableChannelsByTag 手动禁用标签下的所有渠道
+// POST /api/admin/channel/tag/disable
+func DisableChannelsByTag(c *gin.Context) {
+	setChannelStatusByTag(c, false)
+}
+
+func setChannelStatusByTag(c *gin.Context, enabled bool) {
+	var req ChannelTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		channelBadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	var err error
+	if enabled {
+		err = model.EnableChannelByTag(req.Tag)
+	} else {
+		err = model.DisableChannelByTag(req.Tag)
+	}
+	if err != nil {
+		channelManageError(c, err, "update status of tagged")
+		return
+	}
+	reloadChannelCache("")
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "状态更新成功",
+	})
+}
+
+// EditChannelsByTag 按标签批量修改标签、模型、分组、优先级、权重、模型重定向和覆盖配置，
+// 修改模型或分组时重建能力表
+// PUT /api/admin/channel/tag
+func EditChannelsByTag(c *gin.Context) {
+	var req EditChannelTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		channelBadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	settings := model.Channel{
+		ModelMapping:   req.ModelMapping,
+		ParamOverride:  req.ParamOverride,
+		HeaderOverride: req.HeaderOverride,
+	}
+	if err := settings.ValidateSettings(); err != nil {
+		channelBadRequest(c, err.Error())
+		return
+	}
+	if err := model.EditChannelByTag(req.Tag, req.NewTag, req.ModelMapping, req.Models, req.Group, req.Priority, req.Weight, req.ParamOverride, req.HeaderOverride); err != nil {
+		channelManageError(c, err, "edit tagged")
+		return
+	}
+	reloadChannelCache("")
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "更新成功",
+	})
+}
+
+// BatchSetChannelTag 批量设置渠道标签
+// POST /api/admin/channel/tag/batch
+func BatchSetChannelTag(c *gin.Context) {
+	var req BatchSetChannelTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		channelBadRequest(c, "参数错误: "+err.Error())
+		return
+	}
+	if len(req.Ids) == 0 {
+		channelBadRequest(c, "ids 不能为空")
+		return
+	}
+	if req.Tag != nil && *req.Tag == "" {
+		req.Tag = nil
+	}
+	if err := model.BatchSetChannelTag(req.Ids, req.Tag); err != nil {
+		channelManageError(c, err, "set tag of")
+		return
+	}
+	reloadChannelCache("")
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "更新成功",
+		Data:    len(req.Ids),
+	})
+}
+
+// EnableChannelKey 启用多 key 渠道中指定下标的 key
+// POST /api/admin/channel/:id/keys/:index/enable
+func EnableChannelKey(c *gin.Context) {
+	setChannelKeyStatus(c, common.ChannelStatusEnabled, "")
+}
+
+// DisableChannelKey 手动禁用多 key 渠道中指定下标的 key，可在请求体中填写原因
+// POST /api/admin/channel/:id/keys/:index/disable
+func DisableChannelKey(c *gin.Context) {
+	var req ChannelKeyStatusRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			channelBadRequest(c, "参数错误: "+err.Error())
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "manually disabled"
+	}
+	setChannelKeyStatus(c, common.ChannelStatusManuallyDisabled, req.Reason)
+}
+
+func setChannelKeyStatus(c *gin.Context, status int, reason string) {
+	keyIndex, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		channelBadRequest(c, "key 下标格式错误")
+		return
+	}
+	channel, err := model.UpdateChannelKeyStatus(c.Param("id"), keyIndex, status, reason)
+	if err != nil {
+		if errors.Is(err, model.ErrChannelNotMultiKey) || errors.Is(err, model.ErrChannelKeyIndexOutOfRange) {
+			channelBadRequest(c, err.Error())
+		} else {
+			channelManageError(c, err, "update key status of")
+		}
+		return
+	}
+	reloadChannelCache(channel.Id)
+	channel.Key = ""
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "状态更新成功",
+		Data:    channel,
+	})
+}
+
+// FixChannelAbilities 按渠道表重建能力表
+// POST /api/admin/channel/abilities/fix
+func FixChannelAbilities(c *gin.Context) {
+	success, fails, err := model.FixAbility()
+	if err != nil {
+		channelManageError(c, err, "fix abilities of")
+		return
+	}
+	// 渠道缓存的分组、模型来自 t_abilities，重建后需要在所有节点重新加载
+	reloadChannelCache("")
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "修复完成",
+		Data: FixChannelAbilitiesData{
+			Success: success,
+			Fails:   fails,
+		},
+	})
+}
+
+// ReloadChannelCache 从数据库重新加载所有节点的渠道缓存
+// POST /api/admin/channel/cache/reload
+func ReloadChannelCache(c *gin.Context) {
+	reloadChannelCache("")
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "渠道缓存已重新加载",
+	})
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 渠道熔断 ==========
+
+// ChannelAdminResponse 渠道管理接口通用响应结构
+type ChannelAdminResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ResetChannelBreakerRequest 恢复熔断请求结构
+type ResetChannelBreakerRequest struct {
+	ChannelId string `json:"channel_id" binding:"required"`
+	Model     string `json:"model"` // 为空表示恢复该渠道的所有模型
+}
+
+// GetChannelBreakers 查询本节点当前存在失败记录或已熔断的 渠道+模型
+// GET /api/admin/channel/breakers
+func GetChannelBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "查询成功",
+		Data:    model.GetChannelBreakers(),
+	})
+}
+
+// ResetChannelBreaker 手动恢复熔断的渠道，仅作用于处理该请求的节点
+// POST /api/admin/channel/breakers/reset
+func ResetChannelBreaker(c *gin.Context) {
+	var req ResetChannelBreakerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+			Success: false,
+			Message: "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	count := model.ResetChannelBreakers(req.ChannelId, req.Model)
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: fmt.Sprintf("已恢复 %d 个熔断记录", count),
+		Data:    gin.H{"reset": count},
+	})
+}
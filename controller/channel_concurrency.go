@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"net/http"
+
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelConcurrencyStats 查询本节点设置了并发限制的渠道的并发数、排队数和等待时间
+// GET /api/admin/channel/concurrency
+func GetChannelConcurrencyStats(c *gin.Context) {
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "查询成功",
+		Data:    model.GetChannelConcurrencyStats(),
+	})
+}
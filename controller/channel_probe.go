@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/dto"
+	"relay-gateway/middleware"
+	"relay-gateway/model"
+	"relay-gateway/relay"
+	relaycommon "relay-gateway/relay/common"
+	"relay-gateway/relay/helper"
+	"relay-gateway/service"
+	"relay-gateway/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 渠道主动探测 ==========
+
+// 主节点定期使用渠道的测试模型发送最小请求，更新响应时间和测试时间；
+// 自动禁用的渠道（多 key 渠道为自动禁用的 key）连续探测成功达到阈值后自动启用。
+// 手动禁用的渠道和 key 不探测
+
+// channelProbeTarget 一次探测的目标，非多 key 渠道 keyIndex 为 -1
+type channelProbeTarget struct {
+	channel  *model.Channel
+	key      string
+	keyIndex int
+	// 目标当前是否为自动禁用状态，探测成功后需要启用
+	autoDisabled bool
+}
+
+func (t channelProbeTarget) name() string {
+	if t.keyIndex < 0 {
+		return t.channel.Id
+	}
+	return fmt.Sprintf("%s:%d", t.channel.Id, t.keyIndex)
+}
+
+var (
+	// 自动禁用目标的连续探测成功次数
+	channelProbeSuccesses     = make(map[string]int)
+	channelProbeSuccessesLock sync.Mutex
+)
+
+// StartChannelProbe 按 CHANNEL_PROBE_INTERVAL 定期探测所有渠道，间隔为 0 时不启动
+func StartChannelProbe() {
+	if constant.ChannelProbeIntervalSeconds <= 0 {
+		return
+	}
+	interval := time.Duration(constant.ChannelProbeIntervalSeconds) * time.Second
+	common.SysLog(fmt.Sprintf("channel probe started, interval: %s, concurrency: %d", interval, constant.ChannelProbeConcurrency))
+	for {
+		ProbeAllChannels()
+		time.Sleep(interval)
+	}
+}
+
+// ProbeAllChannels 探测一轮所有启用和自动禁用的渠道
+func ProbeAllChannels() {
+	channels, err := model.GetAllChannels(0, 0, true, false)
+	if err != nil {
+		common.SysLog("failed to get channels for probe: " + err.Error())
+		return
+	}
+	targets := make([]channelProbeTarget, 0, len(channels))
+	for _, channel := range channels {
+		targets = append(targets, getChannelProbeTargets(channel)...)
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	concurrency := constant.ChannelProbeConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		target := target
+		sem <- struct{}{}
+		wg.Add(1)
+		gopool.Go(func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			probeChannelTarget(target)
+		})
+	}
+	wg.Wait()
+}
+
+// getChannelProbeTargets 多 key 渠道逐个探测启用和自动禁用的 key
+func getChannelProbeTargets(channel *model.Channel) []channelProbeTarget {
+	if channel.Status != common.ChannelStatusEnabled && channel.Status != common.ChannelStatusAutoDisabled {
+		return nil
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return []channelProbeTarget{{
+			channel:      channel,
+			key:          channel.Key,
+			keyIndex:     -1,
+			autoDisabled: channel.Status == common.ChannelStatusAutoDisabled,
+		}}
+	}
+	keys := channel.GetKeys()
+	targets := make([]channelProbeTarget, 0, len(keys))
+	for i, key := range keys {
+		status, ok := channel.ChannelInfo.MultiKeyStatusList[i]
+		if !ok {
+			status = common.ChannelStatusEnabled
+		}
+		if status != common.ChannelStatusEnabled && status != common.ChannelStatusAutoDisabled {
+			continue
+		}
+		targets = append(targets, channelProbeTarget{
+			channel:      channel,
+			key:          key,
+			keyIndex:     i,
+			autoDisabled: status == common.ChannelStatusAutoDisabled || channel.Status == common.ChannelStatusAutoDisabled,
+		})
+	}
+	return targets
+}
+
+func probeChannelTarget(target channelProbeTarget) {
+	responseTime, newAPIError := probeChannel(target.channel, target.key)
+	if newAPIError == nil {
+		// 多 key 渠道的响应时间以最后一个探测成功的 key 为准
+		target.channel.UpdateResponseTime(responseTime.Milliseconds())
+	} else if common.DebugEnabled {
+		common.SysLog(fmt.Sprintf("channel probe failed: target=%s, error=%s", target.name(), newAPIError.Error()))
+	}
+	if !target.autoDisabled {
+		return
+	}
+
+	channelProbeSuccessesLock.Lock()
+	successes := 0
+	if newAPIError == nil {
+		successes = channelProbeSuccesses[target.name()] + 1
+	}
+	if successes == 0 || successes >= constant.ChannelProbeEnableThreshold {
+		delete(channelProbeSuccesses, target.name())
+	} else {
+		channelProbeSuccesses[target.name()] = successes
+	}
+	channelProbeSuccessesLock.Unlock()
+
+	if successes < constant.ChannelProbeEnableThreshold || !service.ShouldEnableChannel(newAPIError, common.ChannelStatusAutoDisabled) {
+		return
+	}
+	if model.UpdateChannelStatus(target.channel.Id, target.key, common.ChannelStatusEnabled, "") {
+		// 状态更新只修改缓存中的渠道状态，需重新加载分组路由才会重新选中该渠道；
+		// 本节点不会处理自己发布的事件，因此在本地重新加载并通知其他节点
+		model.InvalidateCache(model.CacheInvalidationChannel, target.channel.Id)
+		common.SysLog(fmt.Sprintf("通道「%s」（#%s）连续 %d 次探测成功，已自动启用", target.channel.Name, target.name(), successes))
+	}
+}
+
+// probeChannel 使用渠道的适配器和测试模型发送一次最小的非流式对话请求，不计费、不记录日志
+func probeChannel(channel *model.Channel, key string) (time.Duration, *types.NewAPIError) {
+	testModel := ""
+	if channel.TestModel != nil && *channel.TestModel != "" {
+		testModel = *channel.TestModel
+	} else if models := channel.GetModels(); len(models) > 0 {
+		testModel = models[0]
+	}
+	if testModel == "" {
+		return 0, types.NewError(errors.New("渠道未配置测试模型"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// 只使用指定的 key，避免影响多 key 渠道的轮询位置
+	probe := *channel
+	probe.Key = key
+	probe.Keys = nil
+	probe.ChannelInfo.IsMultiKey = false
+	if newAPIError := middleware.SetupContextForSelectedChannel(c, &probe, testModel); newAPIError != nil {
+		return 0, newAPIError
+	}
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, testModel)
+
+	request := &dto.GeneralOpenAIRequest{
+		Model: testModel,
+		Messages: []dto.Message{
+			{
+				Role:    "user",
+				Content: constant.ChannelProbePrompt,
+			},
+		},
+	}
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatOpenAI, request, nil)
+	if err != nil {
+		return 0, types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+	}
+	info.InitChannelMeta(c)
+	if err := helper.ModelMappedHelper(c, info, request); err != nil {
+		return 0, types.NewError(err, types.ErrorCodeChannelModelMappedError)
+	}
+	adaptor := relay.GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return 0, types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType)
+	}
+	adaptor.Init(info)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
+	if err != nil {
+		return 0, types.NewError(err, types.ErrorCodeConvertRequestFailed)
+	}
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return 0, types.NewError(err, types.ErrorCodeJsonMarshalFailed)
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride)
+		if err != nil {
+			return 0, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid)
+		}
+	}
+
+	start := time.Now()
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	httpResp, ok := resp.(*http.Response)
+	if !ok || httpResp == nil {
+		return 0, types.NewError(errors.New("empty response"), types.ErrorCodeBadResponse)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return 0, service.RelayErrorHandler(c.Request.Context(), httpResp, true)
+	}
+	if _, newAPIError := adaptor.DoResponse(c, httpResp, info); newAPIError != nil {
+		return 0, newAPIError
+	}
+	return time.Since(start), nil
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"net/http"
+
+	"relay-gateway/model"
+	"relay-gateway/relay/helper"
+	"relay-gateway/service"
+	"relay-gateway/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExplainChannelRouteRequest 渠道路由诊断请求结构，group 和 token 至少填写一个
+type ExplainChannelRouteRequest struct {
+	Group string `json:"group"` // 分组，填写 token 时可为空，使用令牌实际使用的分组
+	Token string `json:"token"` // 令牌 key，用于按令牌和用户解析分组（包括 auto 分组）
+	Model string `json:"model" binding:"required"`
+	Retry int    `json:"retry"` // 第几次重试，0 为首次选择
+}
+
+// ExplainChannelRouteResponse 渠道路由诊断结果
+type ExplainChannelRouteResponse struct {
+	Group     string                       `json:"group"`
+	UserGroup string                       `json:"user_group,omitempty"`
+	Model     string                       `json:"model"`
+	Retry     int                          `json:"retry"`
+	Groups    []*model.ChannelRouteExplain `json:"groups"` // auto 分组时按顺序列出各分组，实际使用第一个有可用渠道的分组
+}
+
+// ExplainChannelRoute 诊断分组（或令牌）+模型在第 retry 次重试时的候选渠道、有效权重、选中概率和被排除的原因，
+// 只读取处理该请求的节点的缓存和状态，不发送上游请求
+// POST /api/admin/channel/route/explain
+func ExplainChannelRoute(c *gin.Context) {
+	var req ExplainChannelRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+			Success: false,
+			Message: "参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.Group == "" && req.Token == "" {
+		c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+			Success: false,
+			Message: "group 和 token 不能同时为空",
+		})
+		return
+	}
+	if req.Retry < 0 {
+		req.Retry = 0
+	}
+
+	result := ExplainChannelRouteResponse{
+		Group: req.Group,
+		Model: req.Model,
+		Retry: req.Retry,
+	}
+	// 与令牌认证相同：令牌指定了分组时使用令牌的分组，否则使用用户分组
+	if req.Token != "" {
+		token, err := model.GetTokenEnhancedByKey(req.Token, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+				Success: false,
+				Message: "令牌不存在: " + err.Error(),
+			})
+			return
+		}
+		user, err := model.GetUserCache(token.UserId)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ChannelAdminResponse{
+				Success: false,
+				Message: "用户不存在: " + err.Error(),
+			})
+			return
+		}
+		result.UserGroup = user.Group
+		if req.Group == "" {
+			result.Group = user.Group
+			if token.Group != "" {
+				result.Group = token.Group
+			}
+		}
+	}
+
+	groups := []string{result.Group}
+	if result.Group == "auto" {
+		if result.UserGroup != "" {
+			groups = service.GetUserAutoGroup(result.UserGroup)
+		} else {
+			groups = setting.GetAutoGroups()
+		}
+	}
+	result.Groups = make([]*model.ChannelRouteExplain, 0, len(groups))
+	for _, group := range groups {
+		explain, err := model.ExplainChannelRoute(group, req.Model, req.Retry)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ChannelAdminResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		explainModelMapping(explain)
+		result.Groups = append(result.Groups, explain)
+	}
+
+	c.JSON(http.StatusOK, ChannelAdminResponse{
+		Success: true,
+		Message: "查询成功",
+		Data:    result,
+	})
+}
+
+// explainModelMapping 按各候选渠道的模型重定向配置填写上游模型名
+func explainModelMapping(explain *model.ChannelRouteExplain) {
+	for i := range explain.Tiers {
+		for j := range explain.Tiers[i].Candidates {
+			candidate := &explain.Tiers[i].Candidates[j]
+			channel, err := model.CacheGetChannel(candidate.ChannelId)
+			if err != nil {
+				continue
+			}
+			upstreamModel, mapped, err := helper.MapModelName(channel.GetModelMapping(), explain.Model)
+			if err != nil {
+				candidate.MappingError = err.Error()
+				continue
+			}
+			candidate.UpstreamModel = upstreamModel
+			candidate.ModelMapped = mapped
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ========== 子令牌 ==========
+
+// 未指定有效期时默认 15 分钟
+const defaultChildTokenTTLSeconds = 15 * 60
+
+// CreateChildTokenRequest 签发子令牌请求结构
+type CreateChildTokenRequest struct {
+	ExpiresIn  int      `json:"expires_in"`  // 有效期（秒），不超过 CHILD_TOKEN_MAX_TTL
+	Models     []string `json:"models"`      // 允许使用的模型，需在父令牌模型限制内，为空表示沿用父令牌
+	SpendLimit int      `json:"spend_limit"` // 消费上限（额度，即美分），0 表示不限制
+	RateLimit  int      `json:"rate_limit"`  // 每分钟请求数，0 表示不限制
+}
+
+// CreateChildTokenData 签发结果
+type CreateChildTokenData struct {
+	Token     string   `json:"token"`
+	TokenType string   `json:"token_type"`
+	ExpiresIn int      `json:"expires_in"`
+	ExpiresAt int64    `json:"expires_at"`
+	Models    []string `json:"models,omitempty"`
+}
+
+// CreateChildToken 使用当前请求的令牌签发短期子令牌（JWT），子令牌不能再签发子令牌
+// POST /v1/tokens/child
+func CreateChildToken(c *gin.Context) {
+	if common.GetContextKeyString(c, constant.ContextKeyChildTokenId) != "" {
+		c.JSON(http.StatusForbidden, TokenManageResponse{
+			Success: false,
+			Message: "子令牌不能签发子令牌",
+		})
+		return
+	}
+	var req CreateChildTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = defaultChildTokenTTLSeconds
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > constant.ChildTokenMaxTTLSeconds {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: fmt.Sprintf("expires_in 需在 1-%d 之间", constant.ChildTokenMaxTTLSeconds),
+		})
+		return
+	}
+	if req.SpendLimit < 0 || req.RateLimit < 0 {
+		c.JSON(http.StatusBadRequest, TokenManageResponse{
+			Success: false,
+			Message: "spend_limit 和 rate_limit 不能为负数",
+		})
+		return
+	}
+
+	parent, err := model.GetTokenEnhancedByIdCached(common.GetContextKeyString(c, constant.ContextKeyTokenId))
+	if err != nil {
+		tokenManageError(c, err, "get parent")
+		return
+	}
+	if parent.ModelLimitsEnabled {
+		parentLimits := parent.GetModelLimitsMap()
+		for _, modelName := range req.Models {
+			if !parentLimits[modelName] {
+				c.JSON(http.StatusBadRequest, TokenManageResponse{
+					Success: false,
+					Message: "模型 " + modelName + " 不在父令牌的模型限制内",
+				})
+				return
+			}
+		}
+	}
+
+	token, expiresAt, err := model.SignChildToken(parent, time.Duration(req.ExpiresIn)*time.Second, req.Models, req.SpendLimit, req.RateLimit)
+	if err != nil {
+		common.SysLog("Failed to sign child token, error: " + err.Error())
+		c.JSON(http.StatusInternalServerError, TokenManageResponse{
+			Success: false,
+			Message: "签发子令牌失败",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, TokenManageResponse{
+		Success: true,
+		Message: "子令牌签发成功",
+		Data: CreateChildTokenData{
+			Token:     token,
+			TokenType: "Bearer",
+			ExpiresIn: req.ExpiresIn,
+			ExpiresAt: expiresAt.Unix(),
+			Models:    req.Models,
+		},
+	})
+}
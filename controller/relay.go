@@ -86,6 +86,16 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+			// 流式响应已经写出数据时只能以错误事件结束，未写出时清除 SSE 头部后返回 JSON 错误
+			if relayFormat != types.RelayFormatOpenAIRealtime {
+				if c.Writer.Written() {
+					if _, exists := c.Get("event_stream_headers_set"); exists {
+						helper.StreamErrorEvent(c, relayFormat, newAPIError)
+					}
+					return
+				}
+				helper.ResetEventStreamHeaders(c)
+			}
 			switch relayFormat {
 			case types.RelayFormatOpenAIRealtime:
 				helper.WssError(c, ws, newAPIError.ToOpenAIError())
@@ -144,6 +154,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
+		newAPIError = service.CheckTokenSpendingLimit(c, relayInfo)
+		if newAPIError != nil {
+			return
+		}
 		newAPIError = service.PreConsumeQuota(c, priceData.QuotaToPreConsume, relayInfo)
 		if newAPIError != nil {
 			return
@@ -157,12 +171,37 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	newAPIError = relayWithRetry(c, relayInfo, relayFormat, group, originalModel, startTime)
+	// 请求的模型所有渠道都失败时，按分组配置的降级链切换到下一个模型
+	for _, fallbackModel := range setting.GetModelFallbacks(group, originalModel) {
+		if !shouldFallbackModel(newAPIError) {
+			break
+		}
+		if fallbackErr := switchFallbackModel(c, relayInfo, group, fallbackModel, meta); fallbackErr != nil {
+			logger.LogWarn(c, fmt.Sprintf("fallback to model %s failed: %s", fallbackModel, fallbackErr.Error()))
+			continue
+		}
+		newAPIError = relayWithRetry(c, relayInfo, relayFormat, group, fallbackModel, startTime)
+	}
+	if newAPIError == nil {
+		return
+	}
+
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		logger.LogInfo(c, retryLogStr)
+	}
+}
+
+// relayWithRetry 使用上下文中已选中的渠道请求模型，失败时按重试规则切换渠道
+func relayWithRetry(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, group string, modelName string, startTime time.Time) *types.NewAPIError {
+	var newAPIError *types.NewAPIError
 	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, group, originalModel, i)
+		channel, err := getChannel(c, group, modelName, i)
 		if err != nil {
 			logger.LogError(c, err.Error())
-			newAPIError = err
-			break
+			return err
 		}
 
 		addUsedChannel(c, channel.Id)
@@ -170,33 +209,27 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 		elapsed := time.Since(startTime)
 		fmt.Printf("请求耗时2222================：%s\n", elapsed)
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		if i == 0 && shouldHedgeRequest(c, relayInfo, relayFormat, group, modelName) {
+			channel, newAPIError = relayWithHedge(c, relayInfo, relayFormat, group, channel, modelName)
+		} else {
+			newAPIError = relayAttempt(c, relayInfo, relayFormat, channel, modelName)
 		}
 
 		if newAPIError == nil {
-			return
+			service.RecordChannelAffinity(c, channel.Id)
+			return nil
 		}
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+		// 并发已满不计入渠道健康度和熔断，直接尝试其他渠道
+		if newAPIError.GetErrorCode() != types.ErrorCodeChannelConcurrencyFull {
+			processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+		}
 
 		if !shouldRetry(c, newAPIError, common.RetryTimes-i) {
 			break
 		}
 	}
-
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		logger.LogInfo(c, retryLogStr)
-	}
+	return newAPIError
 }
 
 var upgrader = websocket.Upgrader{
@@ -212,6 +245,44 @@ func addUsedChannel(c *gin.Context, channelId string) {
 	c.Set("use_channel", useChannel)
 }
 
+// relayAttempt 使用上下文中已选中的渠道执行一次请求，并记录渠道健康度和熔断结果
+func relayAttempt(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel, originalModel string) *types.NewAPIError {
+	releaseConcurrency, concurrencyErr := acquireChannelConcurrency(c, channel.Id)
+	if concurrencyErr != nil {
+		logger.LogWarn(c, fmt.Sprintf("channel #%s concurrency full: %s", channel.Id, concurrencyErr.Error()))
+		return concurrencyErr
+	}
+	releaseInflight := acquireChannelKeyInflight(c, channel.Id)
+	consumeChannelBudget(c, channel.Id, originalModel, relayInfo.PromptTokens)
+	attemptStart := time.Now()
+	var newAPIError *types.NewAPIError
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		newAPIError = relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		newAPIError = relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		newAPIError = geminiRelayHandler(c, relayInfo)
+	default:
+		newAPIError = relayHandler(c, relayInfo)
+	}
+	releaseInflight()
+	releaseConcurrency()
+	// 对冲请求中落败被取消的尝试不计入健康度和熔断
+	if relayInfo.Hedge != nil && relayInfo.Hedge.Lost() {
+		return newAPIError
+	}
+	recordChannelHealth(c, relayInfo, channel.Id, relayFormat, attemptStart, newAPIError)
+	if newAPIError == nil || !isChannelHealthFailure(newAPIError) {
+		// 上游正常响应（包括请求参数错误）即视为渠道可用，失败由 processChannelError 记录
+		model.RecordChannelBreakerResult(channel.Id, originalModel, true, "")
+	}
+	if newAPIError == nil && common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		model.ClearChannelKeyCooldown(channel.Id, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex))
+	}
+	return newAPIError
+}
+
 func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*model.Channel, *types.NewAPIError) {
 	if retryCount == 0 {
 		autoBan := c.GetBool("auto_ban")
@@ -240,6 +311,71 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 	return channel, nil
 }
 
+// acquireChannelConcurrency 渠道设置了 max_concurrency 时占用一个并发名额，已满时排队等待，返回释放函数
+func acquireChannelConcurrency(c *gin.Context, channelId string) (func(), *types.NewAPIError) {
+	channelSetting, _ := common.GetContextKeyType[dto.ChannelSettings](c, constant.ContextKeyChannelSetting)
+	release, err := model.AcquireChannelConcurrency(c.Request.Context(), channelId, channelSetting.MaxConcurrency)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeChannelConcurrencyFull, http.StatusTooManyRequests)
+	}
+	return release, nil
+}
+
+// consumeChannelBudget 按渠道设置的上游 RPM、TPM 扣减预算，实际用量在计费时校正
+func consumeChannelBudget(c *gin.Context, channelId string, modelName string, promptTokens int) {
+	channelSetting, _ := common.GetContextKeyType[dto.ChannelSettings](c, constant.ContextKeyChannelSetting)
+	model.ConsumeChannelBudget(channelId, modelName, channelSetting, promptTokens)
+}
+
+// acquireChannelKeyInflight least_inflight 模式的多 key 渠道在请求期间占用 key 的进行中计数，返回释放函数
+func acquireChannelKeyInflight(c *gin.Context, channelId string) func() {
+	if !common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) ||
+		common.GetContextKeyString(c, constant.ContextKeyChannelMultiKeyMode) != string(constant.MultiKeyModeLeastInflight) {
+		return func() {}
+	}
+	keyIndex := common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	model.AcquireChannelKeyInflight(channelId, keyIndex)
+	return func() {
+		model.ReleaseChannelKeyInflight(channelId, keyIndex)
+	}
+}
+
+// recordChannelHealth 记录本次尝试的渠道健康度，只有上游故障（渠道错误、超时、429、5xx）计为失败，
+// 请求参数等其他错误不计入
+func recordChannelHealth(c *gin.Context, relayInfo *relaycommon.RelayInfo, channelId string, relayFormat types.RelayFormat, attemptStart time.Time, apiErr *types.NewAPIError) {
+	keyIndex := -1
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	if apiErr != nil {
+		if isChannelHealthFailure(apiErr) {
+			model.RecordChannelHealth(channelId, keyIndex, false, 0, 0)
+		}
+		return
+	}
+	// 实时语音的耗时是会话时长，不统计延迟
+	if relayFormat == types.RelayFormatOpenAIRealtime {
+		model.RecordChannelHealth(channelId, keyIndex, true, 0, 0)
+		return
+	}
+	latency := time.Since(attemptStart)
+	ttft := latency
+	if relayInfo.FirstResponseTime.After(attemptStart) {
+		ttft = relayInfo.FirstResponseTime.Sub(attemptStart)
+	}
+	model.RecordChannelHealth(channelId, keyIndex, true, ttft, latency)
+}
+
+func isChannelHealthFailure(apiErr *types.NewAPIError) bool {
+	if types.IsChannelError(apiErr) {
+		return true
+	}
+	if types.IsSkipRetryError(apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode/100 == 5
+}
+
 func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -286,7 +422,13 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
-	if service.ShouldDisableChannel(channelError.ChannelType, err) && channelError.AutoBan {
+	if isChannelHealthFailure(err) {
+		model.RecordChannelBreakerResult(channelError.ChannelId, c.GetString("original_model"), false, err.Error())
+	}
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) && service.ShouldCooldownChannelKey(err) {
+		// 多 key 渠道的 key 限流或额度不足时临时冷却，到期后自动恢复
+		model.CooldownChannelKey(channelError.ChannelId, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex), err.RetryAfter)
+	} else if service.ShouldDisableChannel(channelError.ChannelType, err) && channelError.AutoBan {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.Error())
 		})
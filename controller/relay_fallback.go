@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/logger"
+	"relay-gateway/middleware"
+	relaycommon "relay-gateway/relay/common"
+	"relay-gateway/relay/helper"
+	"relay-gateway/service"
+	"relay-gateway/setting/ratio_setting"
+	"relay-gateway/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldFallbackModel 模型的渠道均不可用或上游故障时才降级，请求参数、额度等错误直接返回
+func shouldFallbackModel(apiErr *types.NewAPIError) bool {
+	if apiErr == nil {
+		return false
+	}
+	switch apiErr.GetErrorCode() {
+	case types.ErrorCodeGetChannelFailed, types.ErrorCodeChannelConcurrencyFull:
+		return true
+	}
+	return isChannelHealthFailure(apiErr)
+}
+
+// isTokenModelAllowed 令牌开启模型限制时检查是否允许访问模型，与 Distribute 的检查一致
+func isTokenModelAllowed(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	s, ok := common.GetContextKey(c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	tokenModelLimit, ok := s.(map[string]bool)
+	if !ok {
+		return false
+	}
+	_, ok = tokenModelLimit[ratio_setting.FormatMatchingModelName(modelName)]
+	return ok
+}
+
+// switchFallbackModel 切换到降级模型：选择该模型的渠道，按降级模型的价格重新预扣费，
+// 请求在各适配器转换时使用新的模型名
+func switchFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, group string, fallbackModel string, meta *types.TokenCountMeta) error {
+	if !isTokenModelAllowed(c, fallbackModel) {
+		return errors.New("该令牌无权访问模型 " + fallbackModel)
+	}
+	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(c, group, fallbackModel, 0)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return fmt.Errorf("分组 %s 下模型 %s 无可用渠道", selectGroup, fallbackModel)
+	}
+
+	service.ReturnPreConsumedQuota(c, relayInfo)
+	relayInfo.FinalPreConsumedQuota = 0
+	if relayInfo.FallbackFromModel == "" {
+		relayInfo.FallbackFromModel = relayInfo.OriginModelName
+	}
+	relayInfo.OriginModelName = fallbackModel
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, fallbackModel)
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, relayInfo.PromptTokens, meta)
+	if err != nil {
+		return err
+	}
+	if !priceData.FreeModel {
+		if apiErr := service.PreConsumeQuota(c, priceData.QuotaToPreConsume, relayInfo); apiErr != nil {
+			return apiErr
+		}
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(c, channel, fallbackModel); apiErr != nil {
+		return apiErr
+	}
+	c.Header("X-Served-Model", fallbackModel)
+	logger.LogInfo(c, fmt.Sprintf("模型 %s 的渠道均不可用，降级到模型 %s", relayInfo.FallbackFromModel, fallbackModel))
+	return nil
+}
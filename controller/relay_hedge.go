@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http/httptest"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/logger"
+	"relay-gateway/middleware"
+	"relay-gateway/model"
+	relaycommon "relay-gateway/relay/common"
+	relayconstant "relay-gateway/relay/constant"
+	"relay-gateway/service"
+	"relay-gateway/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 选择对冲渠道时，随机选中首个渠道后重新选择的次数
+const hedgeChannelSelectAttempts = 3
+
+// hedgeAttempt 对冲请求中的一次尝试，每次尝试使用独立的上下文和响应缓冲，胜出后再写回原请求
+type hedgeAttempt struct {
+	index    int
+	channel  *model.Channel
+	ctx      *gin.Context
+	recorder *httptest.ResponseRecorder
+	cancel   context.CancelFunc
+	err      *types.NewAPIError
+}
+
+// shouldHedgeRequest 只有启用对冲的分组或模型下的非流式对话、补全、向量请求使用对冲
+func shouldHedgeRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, group string, modelName string) bool {
+	if relayInfo.IsStream {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	switch relayFormat {
+	case types.RelayFormatClaude, types.RelayFormatEmbedding:
+	case types.RelayFormatOpenAI:
+		switch relayInfo.RelayMode {
+		case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions:
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	return service.IsChannelHedgeEnabled(group, modelName) || service.IsChannelHedgeEnabled(c.GetString("auto_group"), modelName)
+}
+
+// newHedgeAttempt 复制当前请求的上下文，响应写入缓冲区
+func newHedgeAttempt(c *gin.Context, index int, channel *model.Channel) *hedgeAttempt {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	recorder := httptest.NewRecorder()
+	attemptCtx, _ := gin.CreateTestContext(recorder)
+	attemptCtx.Request = c.Request.Clone(ctx)
+	requestBody, _ := common.GetRequestBody(c)
+	attemptCtx.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	attemptCtx.Keys = maps.Clone(c.Keys)
+	return &hedgeAttempt{
+		index:    index,
+		channel:  channel,
+		ctx:      attemptCtx,
+		recorder: recorder,
+		cancel:   cancel,
+	}
+}
+
+// selectHedgeChannel 在首个渠道所在分组中选择另一个渠道，没有其他可用渠道时返回 nil
+func selectHedgeChannel(c *gin.Context, group string, modelName string, primaryId string) *model.Channel {
+	if autoGroup := c.GetString("auto_group"); autoGroup != "" {
+		group = autoGroup
+	}
+	for i := 0; i < hedgeChannelSelectAttempts; i++ {
+		channel, err := model.GetRandomSatisfiedChannel(group, modelName, 0)
+		if err != nil || channel == nil {
+			return nil
+		}
+		if channel.Id != primaryId {
+			model.AcquireChannelBreaker(channel.Id, modelName)
+			return channel
+		}
+	}
+	return nil
+}
+
+// relayWithHedge 先向首个渠道发出请求，超过对冲延迟仍未完成时向另一个渠道发出相同请求，
+// 先成功的结果写回客户端并取消另一个请求。返回实际使用的渠道，上下文中的渠道信息与之一致
+func relayWithHedge(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, group string, primary *model.Channel, originalModel string) (*model.Channel, *types.NewAPIError) {
+	gate := relaycommon.NewHedgeGate()
+	start := time.Now()
+	results := make(chan *hedgeAttempt, 2)
+	run := func(attempt *hedgeAttempt) {
+		gate.AddChannel(attempt.channel.Id)
+		info := relayInfo.CloneForHedge(gate, attempt.index)
+		go func() {
+			attempt.err = relayAttempt(attempt.ctx, info, relayFormat, attempt.channel, originalModel)
+			results <- attempt
+		}()
+	}
+
+	attempts := []*hedgeAttempt{newHedgeAttempt(c, 0, primary)}
+	run(attempts[0])
+
+	timer := time.NewTimer(service.GetChannelHedgeDelay(group, originalModel))
+	defer timer.Stop()
+	pending := 1
+	var failed []*hedgeAttempt
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if len(attempts) > 1 {
+				continue
+			}
+			hedgeChannel := selectHedgeChannel(c, group, originalModel, primary.Id)
+			if hedgeChannel == nil {
+				continue
+			}
+			attempt := newHedgeAttempt(c, 1, hedgeChannel)
+			if newAPIError := middleware.SetupContextForSelectedChannel(attempt.ctx, hedgeChannel, originalModel); newAPIError != nil {
+				attempt.cancel()
+				continue
+			}
+			logger.LogInfo(c, fmt.Sprintf("hedging request: channel #%s did not respond within %s, sending to channel #%s", primary.Id, time.Since(start).Round(time.Millisecond), hedgeChannel.Id))
+			attempts = append(attempts, attempt)
+			run(attempt)
+			pending++
+		case attempt := <-results:
+			pending--
+			if attempt.err != nil {
+				failed = append(failed, attempt)
+				continue
+			}
+			// 先成功的尝试胜出，取消其他尝试；胜出的尝试还需要异步计费，不取消
+			gate.Resolve(attempt.index)
+			for _, other := range attempts {
+				if other != attempt {
+					other.cancel()
+				}
+			}
+			service.RecordChannelHedgeLatency(group, originalModel, time.Since(start))
+			if len(attempts) > 1 {
+				addUsedChannel(attempt.ctx, attempts[1].channel.Id)
+			}
+			for _, f := range failed {
+				reportHedgeAttemptError(f)
+			}
+			adoptHedgeAttempt(c, attempt)
+			return attempt.channel, nil
+		}
+	}
+
+	// 所有尝试都失败，返回最后失败的尝试由调用方处理，其余尝试在此记录
+	gate.Resolve(-1)
+	for _, attempt := range attempts {
+		attempt.cancel()
+	}
+	last := failed[len(failed)-1]
+	for _, f := range failed[:len(failed)-1] {
+		reportHedgeAttemptError(f)
+	}
+	if len(attempts) > 1 {
+		addUsedChannel(last.ctx, attempts[1].channel.Id)
+	}
+	adoptHedgeAttempt(c, last)
+	return last.channel, last.err
+}
+
+// reportHedgeAttemptError 记录未返回给调用方的失败尝试
+func reportHedgeAttemptError(attempt *hedgeAttempt) {
+	if attempt.err.GetErrorCode() == types.ErrorCodeChannelConcurrencyFull {
+		return
+	}
+	channel := attempt.channel
+	processChannelError(attempt.ctx, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(attempt.ctx, constant.ContextKeyChannelKey), channel.GetAutoBan()), attempt.err)
+}
+
+// adoptHedgeAttempt 将尝试的上下文和响应写回原请求
+func adoptHedgeAttempt(c *gin.Context, attempt *hedgeAttempt) {
+	for key, value := range attempt.ctx.Keys {
+		c.Set(key, value)
+	}
+	if attempt.err != nil {
+		return
+	}
+	header := c.Writer.Header()
+	for key, values := range attempt.recorder.Header() {
+		header[key] = values
+	}
+	c.Writer.WriteHeader(attempt.recorder.Code)
+	_, _ = c.Writer.Write(attempt.recorder.Body.Bytes())
+}
@@ -195,6 +195,8 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 								} else {
 									model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
 									model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
+									model.IncreaseTokenSpending(task.PrivateData.TokenId, quotaDelta)
+									model.AdjustTokenUsageCost(task.PrivateData.TokenId, quotaDelta)
 									task.Quota = actualQuota // 更新任务记录的实际扣费额度
 
 									// 记录消费日志
@@ -217,6 +219,9 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
 									logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
 								} else {
+									// 退还计入任务提交（预扣费）时所在的自然日、自然月
+									model.IncreaseTokenSpendingAt(task.PrivateData.TokenId, -refundQuota, time.Unix(task.SubmitTime, 0))
+									model.AdjustTokenUsageCost(task.PrivateData.TokenId, -refundQuota)
 									task.Quota = actualQuota // 更新任务记录的实际扣费额度
 
 									// 记录退款日志
@@ -7,6 +7,18 @@ type ChannelSettings struct {
 	PassThroughBodyEnabled bool   `json:"pass_through_body_enabled,omitempty"`
 	SystemPrompt           string `json:"system_prompt,omitempty"`
 	SystemPromptOverride   bool   `json:"system_prompt_override,omitempty"`
+	MaxConcurrency         int    `json:"max_concurrency,omitempty"` // 本节点最大并发请求数，0 表示不限制
+	// 上游账号的每分钟请求数、token 数限制，接近限制时降低该渠道的选择权重，0 表示不限制
+	UpstreamRpm int `json:"upstream_rpm,omitempty"`
+	UpstreamTpm int `json:"upstream_tpm,omitempty"`
+	// 按模型的上游限制，未配置的模型使用模型表（t_models）中的 rpm_limit、tpm_limit
+	UpstreamModelLimits map[string]UpstreamLimit `json:"upstream_model_limits,omitempty"`
+}
+
+// UpstreamLimit 上游每分钟请求数和 token 数限制
+type UpstreamLimit struct {
+	Rpm int `json:"rpm,omitempty"`
+	Tpm int `json:"tpm,omitempty"`
 }
 
 type VertexKeyType string
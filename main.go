@@ -52,6 +52,21 @@ func main() {
 		}
 	}()
 
+	// 一次性迁移：回填令牌 key_hash 并清空明文 key，完成后退出
+	if *common.MigrateTokenKeys {
+		if err := model.CheckTokenKeyHashSecret(); err != nil {
+			common.FatalLog("failed to migrate token keys: " + err.Error())
+			return
+		}
+		backfilled, cleared, err := model.MigrateTokenKeysToHashOnly()
+		if err != nil {
+			common.FatalLog("failed to migrate token keys: " + err.Error())
+			return
+		}
+		common.SysLog(fmt.Sprintf("token key migration finished, backfilled: %d, plaintext keys cleared: %d", backfilled, cleared))
+		return
+	}
+
 	if common.RedisEnabled {
 		// for compatibility with old versions
 		common.MemoryCacheEnabled = true
@@ -78,19 +93,42 @@ func main() {
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
 
+	// 渠道健康度在多节点间通过 Redis 共享
+	model.InitChannelHealthSync()
+
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
+	// 缓存失效广播，定期同步作为兜底
+	model.RegisterCacheInvalidationHandler(model.CacheInvalidationPricing, func(key string) {
+		if err := service.ReloadModelRatiosFromDB(); err != nil {
+			common.SysLog("failed to reload model ratios: " + err.Error())
+		}
+	})
+	model.StartCacheInvalidationSubscriber()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateTaskBulk()
 		})
 	}
+	if common.IsMasterNode {
+		// 令牌过期、额度耗尽后更新状态并清除缓存，过期前提醒用户
+		gopool.Go(func() {
+			service.StartTokenLifecycleSweeper()
+		})
+		// 定期探测渠道，自动启用恢复的渠道
+		gopool.Go(func() {
+			controller.StartChannelProbe()
+		})
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
 		common.SysLog("batch update enabled with interval " + strconv.Itoa(common.BatchUpdateInterval) + "s")
 		model.InitBatchUpdater()
 	}
+	// 令牌使用统计（请求数、token 数、消费）在内存中聚合后定期批量写入
+	model.InitTokenUsageFlusher()
 
 	if os.Getenv("ENABLE_PPROF") == "true" {
 		gopool.Go(func() {
@@ -102,6 +140,7 @@ func main() {
 
 	// Initialize HTTP server
 	server := gin.New()
+	middleware.SetUpTrustedProxies(server)
 	server.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
 		common.SysLog(fmt.Sprintf("panic detected: %v", err))
 		c.JSON(http.StatusInternalServerError, gin.H{
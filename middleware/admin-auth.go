@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 管理 API 签名请求头，签名内容为：
+// METHOD\nREQUEST_URI\nTIMESTAMP\nNONCE\nSHA256(BODY)，使用调用方密钥做 HMAC-SHA256，十六进制编码
+const (
+	AdminCallerHeader    = "X-Admin-Caller"
+	AdminTimestampHeader = "X-Admin-Timestamp"
+	AdminNonceHeader     = "X-Admin-Nonce"
+	AdminSignatureHeader = "X-Admin-Signature"
+
+	adminSecretCaller      = "admin-secret"
+	adminAnonymousCaller   = "anonymous"
+	adminNonceMaxLength    = 128
+	adminAuditResultMaxLen = 1024
+	adminMaxBodySize       = 1 << 20 // 管理 API 请求体上限，认证前读取请求体，需要限制大小
+	// 未通过认证的请求只记录有限长度的路径和结果
+	adminAuditUnauthorizedMaxLen = 256
+)
+
+var (
+	adminNonceLocalCache = common.NewLocalCache(10 * time.Minute)
+	adminNonceLock       sync.Mutex
+)
+
+// adminAuditWriter 记录响应内容的前 adminAuditResultMaxLen 字节，用于审计结果
+type adminAuditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *adminAuditWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *adminAuditWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *adminAuditWriter) capture(b []byte) {
+	if remain := adminAuditResultMaxLen - w.body.Len(); remain > 0 {
+		if len(b) > remain {
+			b = b[:remain]
+		}
+		w.body.Write(b)
+	}
+}
+
+// AdminAuth 管理 API 认证，支持静态密钥和 HMAC 签名两种方式，并将每次调用写入审计日志
+func AdminAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, adminMaxBodySize))
+		if err != nil {
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, gin.H{
+				"success": false,
+				"message": "读取请求体失败: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		_ = c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		payloadDigest := sha256.Sum256(body)
+
+		audit := &model.AdminAuditLog{
+			Caller:        adminAnonymousCaller,
+			AuthMethod:    model.AdminAuthMethodNone,
+			Method:        c.Request.Method,
+			Path:          c.Request.URL.RequestURI(),
+			IPAddress:     c.ClientIP(),
+			RequestId:     c.GetString(common.RequestIdKey),
+			PayloadDigest: hex.EncodeToString(payloadDigest[:]),
+		}
+		writer := &adminAuditWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer recordAdminAudit(audit, writer, startTime)
+
+		caller, authMethod, err := authenticateAdminRequest(c, audit.PayloadDigest)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "管理 API 认证失败: " + err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		audit.Caller = caller
+		audit.AuthMethod = authMethod
+		c.Set("admin_caller", caller)
+		c.Next()
+	}
+}
+
+func authenticateAdminRequest(c *gin.Context, payloadDigest string) (caller string, authMethod string, err error) {
+	if constant.AdminSecret == "" && len(constant.AdminHmacSecrets) == 0 {
+		return "", "", errors.New("未配置 ADMIN_SECRET 或 ADMIN_HMAC_SECRETS")
+	}
+	if signature := c.GetHeader(AdminSignatureHeader); signature != "" {
+		caller, err = verifyAdminSignature(c, payloadDigest, signature)
+		if err != nil {
+			return "", "", err
+		}
+		return caller, model.AdminAuthMethodHmac, nil
+	}
+	if constant.AdminSecret != "" {
+		secret := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(constant.AdminSecret)) == 1 {
+			return adminSecretCaller, model.AdminAuthMethodSecret, nil
+		}
+	}
+	return "", "", errors.New("缺少有效的认证信息")
+}
+
+func verifyAdminSignature(c *gin.Context, payloadDigest string, signature string) (string, error) {
+	caller := c.GetHeader(AdminCallerHeader)
+	secret, ok := constant.AdminHmacSecrets[caller]
+	if caller == "" || !ok {
+		return "", errors.New("未知的调用方")
+	}
+	timestampStr := c.GetHeader(AdminTimestampHeader)
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return "", errors.New("时间戳格式错误")
+	}
+	maxSkew := int64(constant.AdminSignatureMaxSkewSeconds)
+	if skew := time.Now().Unix() - timestamp; skew > maxSkew || skew < -maxSkew {
+		return "", errors.New("时间戳已过期")
+	}
+	nonce := c.GetHeader(AdminNonceHeader)
+	if nonce == "" || len(nonce) > adminNonceMaxLength {
+		return "", errors.New("nonce 格式错误")
+	}
+
+	content := strings.Join([]string{c.Request.Method, c.Request.URL.RequestURI(), timestampStr, nonce, payloadDigest}, "\n")
+	expected := common.GenerateHMACWithKey([]byte(secret), content)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return "", errors.New("签名错误")
+	}
+
+	// 签名校验通过后再占用 nonce，避免伪造请求耗尽合法调用方的 nonce
+	used, err := useAdminNonce(caller, nonce, time.Duration(2*maxSkew)*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("nonce 校验失败: %w", err)
+	}
+	if used {
+		return "", errors.New("nonce 已使用")
+	}
+	return caller, nil
+}
+
+// useAdminNonce 占用 nonce，返回该 nonce 是否已被使用过
+func useAdminNonce(caller string, nonce string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("admin_nonce:%s:%s", caller, nonce)
+	if common.RedisEnabled {
+		ok, err := common.RedisSetNX(key, "1", ttl)
+		if err != nil {
+			return false, err
+		}
+		return !ok, nil
+	}
+	adminNonceLock.Lock()
+	defer adminNonceLock.Unlock()
+	if _, ok := adminNonceLocalCache.Get(key); ok {
+		return true, nil
+	}
+	adminNonceLocalCache.SetWithTTL(key, true, ttl)
+	return false, nil
+}
+
+func recordAdminAudit(audit *model.AdminAuditLog, writer *adminAuditWriter, startTime time.Time) {
+	audit.StatusCode = writer.Status()
+	audit.DurationMs = int(time.Since(startTime).Milliseconds())
+	audit.Success = audit.StatusCode < http.StatusBadRequest
+	audit.Result = writer.body.String()
+
+	// 管理 API 统一返回 {success, message}，优先记录其中的结果
+	var resp struct {
+		Success *bool  `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := common.Unmarshal(writer.body.Bytes(), &resp); err == nil && resp.Success != nil {
+		audit.Success = audit.Success && *resp.Success
+		audit.Result = resp.Message
+	}
+	if audit.AuthMethod == model.AdminAuthMethodNone {
+		audit.Path = truncateAdminAuditField(audit.Path, adminAuditUnauthorizedMaxLen)
+		audit.Result = truncateAdminAuditField(audit.Result, adminAuditUnauthorizedMaxLen)
+	}
+
+	if err := model.RecordAdminAuditLog(audit); err != nil {
+		common.SysLog(fmt.Sprintf("failed to record admin audit log: caller=%s, path=%s, error=%v", audit.Caller, audit.Path, err))
+	}
+}
+
+// truncateAdminAuditField 按字符截断，避免截断到多字节字符中间
+func truncateAdminAuditField(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	runes := []rune(s[:maxLen])
+	if len(runes) > 0 && runes[len(runes)-1] == utf8.RuneError {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes)
+}
@@ -10,8 +10,10 @@ import (
 	"relay-gateway/common"
 	"relay-gateway/constant"
 	"relay-gateway/model"
+	relayconstant "relay-gateway/relay/constant"
 	"relay-gateway/service"
 	"relay-gateway/setting/ratio_setting"
+	"relay-gateway/types"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -186,7 +188,15 @@ func TokenAuth() func(c *gin.Context) {
 			//key = parts[0]
 		}
 		var startTimeGetToken = time.Now()
-		token, err := model.ValidateUserTokenEnhanced(key)
+		var token *model.TokenEnhanced
+		var childClaims *model.ChildTokenClaims
+		var err error
+		if model.IsChildToken(key) {
+			// 子令牌只校验签名，费用和各项限制沿用父令牌
+			token, childClaims, err = model.ValidateChildToken(key)
+		} else {
+			token, err = model.ValidateUserTokenEnhanced(key)
+		}
 		elapsed3 := time.Since(startTimeGetToken)
 		fmt.Printf("ValidateUserTokenEnhanced耗时================：%s\n", elapsed3)
 		if token != nil {
@@ -200,13 +210,20 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
-		allowIpsMap := token.GetIpLimitsMapEnhanced()
-		if len(allowIpsMap) != 0 {
-			clientIp := c.ClientIP()
-			if _, ok := allowIpsMap[clientIp]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
-				return
-			}
+		// 使用轮换前的旧 key 时，通过响应头告知剩余有效期
+		if remaining, isPrevious := token.GetPreviousKeyRemaining(key); isPrevious {
+			c.Header("X-Api-Key-Expires-In", strconv.FormatInt(int64(remaining.Seconds()), 10))
+			c.Header("X-Api-Key-Expires-At", token.PreviousKeyExpiresAt.Format(time.RFC3339))
+		}
+
+		if !token.GetIpAccessList().IsAllowed(c.ClientIP()) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中")
+			return
+		}
+		// 接口范围在选择渠道之前检查
+		if scope := relayconstant.Path2EndpointScope(c.Request.URL.Path); !token.AllowsScope(scope) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "该令牌无权访问此接口 "+c.Request.URL.Path, string(types.ErrorCodeTokenScopeDenied))
+			return
 		}
 		var userTime = time.Now()
 		userCache, err := model.GetUserCache(token.UserId)
@@ -242,12 +259,22 @@ func TokenAuth() func(c *gin.Context) {
 			userGroup = tokenGroup
 		}
 		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
+		// 令牌级 分钟/小时/天 请求数限制
+		if !checkTokenRateLimit(c, token) {
+			return
+		}
+		if childClaims != nil && !checkChildTokenRateLimit(c, childClaims) {
+			return
+		}
 		elapsed := time.Since(startTime)
 		fmt.Printf("请求耗时Token================：%s\n", elapsed)
 		err = SetupContextForToken(c, token, parts...)
 		if err != nil {
 			return
 		}
+		if childClaims != nil {
+			setupContextForChildToken(c, token, childClaims)
+		}
 		c.Next()
 	}
 }
@@ -271,9 +298,29 @@ func SetupContextForToken(c *gin.Context, token *model.TokenEnhanced, parts ...s
 		c.Set("token_model_limit_enabled", false)
 	}
 	c.Set("token_group", token.Group)
+	common.SetContextKey(c, constant.ContextKeyTokenDailySpendLimit, token.DailySpendingLimitCents)
+	common.SetContextKey(c, constant.ContextKeyTokenMonthlySpendLimit, token.MonthlySpendingLimitCents)
 	if len(parts) > 1 {
 		abortWithOpenAiMessage(c, http.StatusForbidden, "普通用户不支持指定渠道")
 		return fmt.Errorf("普通用户不支持指定渠道")
 	}
 	return nil
 }
+
+// setupContextForChildToken 子令牌的模型限制取签发时指定的模型与父令牌当前模型限制的交集
+func setupContextForChildToken(c *gin.Context, token *model.TokenEnhanced, claims *model.ChildTokenClaims) {
+	common.SetContextKey(c, constant.ContextKeyChildTokenId, claims.ID)
+	common.SetContextKey(c, constant.ContextKeyChildTokenSpendLimit, claims.SpendLimit)
+	if len(claims.Models) == 0 {
+		return
+	}
+	parentLimits := token.GetModelLimitsMap()
+	modelLimits := make(map[string]bool, len(claims.Models))
+	for _, modelName := range claims.Models {
+		if !token.ModelLimitsEnabled || parentLimits[modelName] {
+			modelLimits[modelName] = true
+		}
+	}
+	c.Set("token_model_limit_enabled", true)
+	c.Set("token_model_limit", modelLimits)
+}
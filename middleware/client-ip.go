@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetUpTrustedProxies 配置受信任的代理和真实 IP 请求头，使 c.ClientIP() 在负载均衡之后也能取到客户端地址
+func SetUpTrustedProxies(server *gin.Engine) {
+	server.RemoteIPHeaders = constant.RemoteIPHeaders
+	if constant.TrustedProxies == nil {
+		common.SysLog("WARNING: TRUSTED_PROXIES is not set, all proxies are trusted and client IP can be spoofed via " + strings.Join(constant.RemoteIPHeaders, "/"))
+		return
+	}
+	if err := server.SetTrustedProxies(constant.TrustedProxies); err != nil {
+		common.FatalLog(fmt.Sprintf("invalid TRUSTED_PROXIES: %v", err))
+	}
+	if len(constant.TrustedProxies) == 0 {
+		common.SysLog("trusted proxies disabled, client IP is taken from the remote address")
+	} else {
+		common.SysLog("trusted proxies: " + strings.Join(constant.TrustedProxies, ","))
+	}
+}
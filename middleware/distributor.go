@@ -95,6 +95,7 @@ func Distribute() func(c *gin.Context) {
 				//		common.SetContextKey(c, constant.ContextKeyUsingGroup, usingGroup)
 				//	}
 				//}
+				service.SetupChannelAffinity(c, usingGroup, modelRequest.Model)
 				channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(c, usingGroup, modelRequest.Model, 0)
 				if err != nil {
 					showGroup := usingGroup
@@ -292,16 +293,18 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
+	key, index, newAPIError := getChannelKey(c, channel)
 	if newAPIError != nil {
 		return newAPIError
 	}
 	if channel.ChannelInfo.IsMultiKey {
 		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, true)
 		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, index)
+		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyMode, string(channel.ChannelInfo.MultiKeyMode))
 	} else {
 		// 必须设置为 false，否则在重试到单个 key 的时候会导致日志显示错误
 		common.SetContextKey(c, constant.ContextKeyChannelIsMultiKey, false)
+		common.SetContextKey(c, constant.ContextKeyChannelMultiKeyMode, "")
 	}
 	// c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	common.SetContextKey(c, constant.ContextKeyChannelKey, key)
@@ -331,6 +334,20 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	return nil
 }
 
+// getChannelKey 选中会话亲和的多 key 渠道时优先使用上次成功的 key，key 不可用时正常选择
+func getChannelKey(c *gin.Context, channel *model.Channel) (string, int, *types.NewAPIError) {
+	if affinity, ok := common.GetContextKeyType[*model.ChannelAffinity](c, constant.ContextKeyChannelAffinityTarget); ok && affinity != nil {
+		// 只在首次选择时使用一次，重试选中同一渠道时重新选择 key
+		common.SetContextKey(c, constant.ContextKeyChannelAffinityTarget, (*model.ChannelAffinity)(nil))
+		if channel.ChannelInfo.IsMultiKey && affinity.ChannelId == channel.Id {
+			if key, ok := channel.GetEnabledKeyByIndex(affinity.KeyIndex); ok {
+				return key, affinity.KeyIndex, nil
+			}
+		}
+	}
+	return channel.GetNextEnabledKey()
+}
+
 // extractModelNameFromGeminiPath 从 Gemini API URL 路径中提取模型名
 // 输入格式: /v1beta/models/gemini-2.0-flash:generateContent
 // 输出: gemini-2.0-flash
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/common/limiter"
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const TokenRateLimitMark = "TKRL"
+
+// 令牌级限流单独使用一个内存限流器，过期时间需覆盖最长的天窗口
+var tokenInMemoryRateLimiter common.InMemoryRateLimiter
+
+var tokenRateLimitWindowNames = map[string]string{
+	"minute": "分钟",
+	"hour":   "小时",
+	"day":    "天",
+}
+
+type tokenRateLimitResult struct {
+	window     model.RateLimitWindow
+	allowed    bool
+	remaining  int
+	resetAfter int64 // 距离恢复一次请求额度的秒数
+}
+
+// checkTokenRateLimit 按令牌配置的 分钟/小时/天 三个窗口同时限流，
+// 并写入 x-ratelimit-* 响应头；超限时中断请求并返回 false
+func checkTokenRateLimit(c *gin.Context, token *model.TokenEnhanced) bool {
+	return checkRateLimitWindows(c, token.Id, token.GetRateLimitWindows())
+}
+
+// checkChildTokenRateLimit 子令牌每分钟请求数按 jti 单独限流，与父令牌的限流同时生效
+func checkChildTokenRateLimit(c *gin.Context, claims *model.ChildTokenClaims) bool {
+	if claims.RateLimit <= 0 {
+		return true
+	}
+	return checkRateLimitWindows(c, "child:"+claims.ID, []model.RateLimitWindow{
+		{Name: "minute", Limit: claims.RateLimit, Duration: 60},
+	})
+}
+
+// checkRateLimitWindows 先检查全部窗口，全部未超限时才在各窗口中计数，
+// 超限的请求不会消耗其他窗口的额度
+func checkRateLimitWindows(c *gin.Context, tokenId string, windows []model.RateLimitWindow) bool {
+	if len(windows) == 0 {
+		return true
+	}
+
+	allowed, results, err := takeTokenRateLimits(tokenId, windows)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("检查令牌速率限制失败: token_id=%s, error=%v", tokenId, err))
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
+		return false
+	}
+
+	var tightest *tokenRateLimitResult
+	for _, result := range results {
+		setTokenRateLimitHeaders(c, "-"+result.window.Name, result)
+		if tightest == nil || result.remaining < tightest.remaining {
+			tightest = result
+		}
+	}
+	if !allowed {
+		// 多个窗口超限时，以需要等待最久的窗口为准
+		var exceeded *tokenRateLimitResult
+		for _, result := range results {
+			if !result.allowed && (exceeded == nil || result.resetAfter > exceeded.resetAfter) {
+				exceeded = result
+			}
+		}
+		setTokenRateLimitHeaders(c, "-requests", exceeded)
+		c.Header("Retry-After", strconv.FormatInt(exceeded.resetAfter, 10))
+		abortWithOpenAiMessage(c, http.StatusTooManyRequests,
+			fmt.Sprintf("令牌已达到速率限制：每%s最多请求%d次", tokenRateLimitWindowNames[exceeded.window.Name], exceeded.window.Limit),
+			"rate_limit_exceeded")
+		return false
+	}
+	// OpenAI 标准头取剩余额度最少的窗口
+	setTokenRateLimitHeaders(c, "-requests", tightest)
+	return true
+}
+
+// takeTokenRateLimits 返回是否全部窗口都允许本次请求，以及各窗口的结果；
+// 单个窗口的 allowed 表示该窗口本身是否还有额度
+func takeTokenRateLimits(tokenId string, windows []model.RateLimitWindow) (bool, []*tokenRateLimitResult, error) {
+	if common.RedisEnabled {
+		return takeTokenRateLimitsRedis(tokenId, windows)
+	}
+	tokenInMemoryRateLimiter.Init(24 * time.Hour)
+	requests := make([]common.RateLimitRequest, len(windows))
+	for i, window := range windows {
+		requests[i] = common.RateLimitRequest{
+			Key:           fmt.Sprintf("%s:%s:%s", TokenRateLimitMark, window.Name, tokenId),
+			MaxRequestNum: window.Limit,
+			Duration:      window.Duration,
+		}
+	}
+	allowed, limits := tokenInMemoryRateLimiter.RequestAllWithRemaining(requests)
+	results := make([]*tokenRateLimitResult, len(windows))
+	for i, window := range windows {
+		results[i] = &tokenRateLimitResult{
+			window:     window,
+			allowed:    limits[i].Allowed,
+			remaining:  limits[i].Remaining,
+			resetAfter: limits[i].ResetAfter,
+		}
+	}
+	return allowed, results, nil
+}
+
+// takeTokenRateLimitsRedis 每个窗口使用一个令牌桶：容量为 limit*duration，每秒补充 limit 个，
+// 每次请求消耗 duration 个，等价于 duration 秒内最多 limit 次请求；全部桶在同一个脚本中检查和扣减
+func takeTokenRateLimitsRedis(tokenId string, windows []model.RateLimitWindow) (bool, []*tokenRateLimitResult, error) {
+	ctx := context.Background()
+	keys := make([]string, len(windows))
+	configs := make([]limiter.Config, len(windows))
+	for i, window := range windows {
+		limit := int64(window.Limit)
+		keys[i] = fmt.Sprintf("rateLimit:%s:%s:%s", TokenRateLimitMark, window.Name, tokenId)
+		configs[i] = limiter.Config{
+			Capacity:  limit * window.Duration,
+			Rate:      limit,
+			Requested: window.Duration,
+		}
+	}
+	allowed, buckets, err := limiter.New(ctx, common.RDB).AllowAllWithRemaining(ctx, keys, configs)
+	if err != nil {
+		return false, nil, err
+	}
+	results := make([]*tokenRateLimitResult, len(windows))
+	for i, window := range windows {
+		tokens := buckets[i].Remaining
+		var resetAfter int64
+		if tokens < configs[i].Capacity {
+			need := window.Duration - tokens%window.Duration
+			resetAfter = (need + configs[i].Rate - 1) / configs[i].Rate
+		}
+		results[i] = &tokenRateLimitResult{
+			window:     window,
+			allowed:    buckets[i].Enough,
+			remaining:  int(tokens / window.Duration),
+			resetAfter: resetAfter,
+		}
+	}
+	return allowed, results, nil
+}
+
+func setTokenRateLimitHeaders(c *gin.Context, suffix string, result *tokenRateLimitResult) {
+	c.Header("x-ratelimit-limit"+suffix, strconv.Itoa(result.window.Limit))
+	c.Header("x-ratelimit-remaining"+suffix, strconv.Itoa(result.remaining))
+	c.Header("x-ratelimit-reset"+suffix, (time.Duration(result.resetAfter) * time.Second).String())
+}
@@ -119,6 +119,14 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 跳过已熔断和所有 key 都在冷却的渠道
+	available := abilities[:0]
+	for _, ability := range abilities {
+		if IsChannelBreakerAvailable(ability.ChannelId, model) && !isChannelCoolingDown(ability.ChannelId) {
+			available = append(available, ability)
+		}
+	}
+	abilities = available
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
@@ -260,15 +268,27 @@ func (channel *Channel) UpdateAbilities(tx *gorm.DB) error {
 	return nil
 }
 
-func UpdateAbilityStatus(channelId string, status bool) error {
-	return DB.Table("t_abilities").Model(&Ability{}).Where("channel_id = ?", channelId).Select("enabled").Update("enabled", status).Error
+// UpdateAbilityStatus tx 为 nil 时直接使用 DB
+func UpdateAbilityStatus(tx *gorm.DB, channelId string, status bool) error {
+	if tx == nil {
+		tx = DB
+	}
+	return tx.Table("t_abilities").Model(&Ability{}).Where("channel_id = ?", channelId).Select("enabled").Update("enabled", status).Error
 }
 
-func UpdateAbilityStatusByTag(tag string, status bool) error {
-	return DB.Table("t_abilities").Model(&Ability{}).Where("tag = ?", tag).Select("enabled").Update("enabled", status).Error
+// UpdateAbilityStatusByTag tx 为 nil 时直接使用 DB
+func UpdateAbilityStatusByTag(tx *gorm.DB, tag string, status bool) error {
+	if tx == nil {
+		tx = DB
+	}
+	return tx.Table("t_abilities").Model(&Ability{}).Where("tag = ?", tag).Select("enabled").Update("enabled", status).Error
 }
 
-func UpdateAbilityByTag(tag string, newTag *string, priority *int64, weight *uint) error {
+// UpdateAbilityByTag tx 为 nil 时直接使用 DB
+func UpdateAbilityByTag(tx *gorm.DB, tag string, newTag *string, priority *int64, weight *uint) error {
+	if tx == nil {
+		tx = DB
+	}
 	ability := Ability{}
 	if newTag != nil {
 		ability.Tag = newTag
@@ -279,7 +299,7 @@ func UpdateAbilityByTag(tag string, newTag *string, priority *int64, weight *uin
 	if weight != nil {
 		ability.Weight = *weight
 	}
-	return DB.Table("t_abilities").Model(&Ability{}).Where("tag = ?", tag).Updates(ability).Error
+	return tx.Table("t_abilities").Model(&Ability{}).Where("tag = ?", tag).Updates(ability).Error
 }
 
 var fixLock = sync.Mutex{}
@@ -307,7 +327,7 @@ func FixAbility() (int, int, error) {
 	}
 	var channels []*Channel
 	// Find all channels
-	err := DB.Table("t_abilities").Model(&Channel{}).Find(&channels).Error
+	err := DB.Find(&channels).Error
 	if err != nil {
 		return 0, 0, err
 	}
@@ -329,7 +349,7 @@ func FixAbility() (int, int, error) {
 		for _, channel := range chunk {
 			err = channel.AddAbilities(nil)
 			if err != nil {
-				common.SysLog(fmt.Sprintf("Add abilities for channel %d failed: %s", channel.Id, err.Error()))
+				common.SysLog(fmt.Sprintf("Add abilities for channel %s failed: %s", channel.Id, err.Error()))
 				failCount++
 			} else {
 				successCount++
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"relay-gateway/common"
+)
+
+const (
+	AdminAuthMethodNone   = "none"
+	AdminAuthMethodSecret = "secret"
+	AdminAuthMethodHmac   = "hmac"
+)
+
+// AdminAuditLog 管理 API 调用审计记录，只追加，不提供修改和删除
+type AdminAuditLog struct {
+	ID            string    `json:"id" gorm:"column:id;type:varchar(32);primaryKey"`
+	Caller        string    `json:"caller" gorm:"column:caller;type:varchar(64);index"`
+	AuthMethod    string    `json:"auth_method" gorm:"column:auth_method;type:varchar(16)"`
+	Method        string    `json:"method" gorm:"column:method;type:varchar(16)"`
+	Path          string    `json:"path" gorm:"column:path;type:text"`
+	IPAddress     string    `json:"ip_address" gorm:"column:ip_address;type:varchar(64)"`
+	RequestId     string    `json:"request_id" gorm:"column:request_id;type:varchar(64)"`
+	PayloadDigest string    `json:"payload_digest" gorm:"column:payload_digest;type:varchar(64)"` // 请求体 SHA256
+	StatusCode    int       `json:"status_code" gorm:"column:status_code;type:int4"`
+	Success       bool      `json:"success" gorm:"column:success;type:bool;default:false"`
+	Result        string    `json:"result" gorm:"column:result;type:text"`
+	DurationMs    int       `json:"duration_ms" gorm:"column:duration_ms;type:int4"`
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at;type:timestamptz(6);default:now();index"`
+}
+
+// TableName 指定表名
+func (AdminAuditLog) TableName() string {
+	return "t_admin_audit_logs"
+}
+
+// RecordAdminAuditLog 写入一条管理 API 审计记录
+func RecordAdminAuditLog(log *AdminAuditLog) error {
+	if log.ID == "" {
+		log.ID = common.GetUUID()
+	}
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+	return DB.Create(log).Error
+}
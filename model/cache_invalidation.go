@@ -0,0 +1,149 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 缓存失效广播：令牌、用户、渠道、配置、定价变更后通过 Redis pub/sub 通知所有节点立即清除本地缓存或重新加载，
+// 按 SYNC_FREQUENCY 的定期同步保留作为兜底。未启用 Redis 时只处理本节点
+
+const cacheInvalidationChannel = "cache_invalidation"
+
+// 缓存失效事件类型
+const (
+	CacheInvalidationToken   = "token"    // key 为令牌 key 的 HMAC
+	CacheInvalidationTokenId = "token_id" // key 为令牌 id，子令牌按 id 缓存父令牌
+	CacheInvalidationUser    = "user"     // key 为用户 id
+	CacheInvalidationChannel = "channel"  // 重新加载渠道缓存，key 为渠道 id，可为空
+	CacheInvalidationOption  = "option"   // 重新加载系统配置，key 为配置项，可为空
+	CacheInvalidationPricing = "pricing"  // 重新加载模型定价和倍率
+)
+
+// CacheInvalidationEvent 缓存失效事件
+type CacheInvalidationEvent struct {
+	Type string `json:"type"`
+	Key  string `json:"key,omitempty"`
+	Node string `json:"node"` // 发布事件的节点，节点忽略自己发布的事件
+}
+
+var (
+	// 本进程的节点标识
+	cacheInvalidationNodeId = common.GetRandomString(16)
+
+	cacheInvalidationHandlers      = make(map[string][]func(key string))
+	cacheInvalidationHandlersLock  sync.RWMutex
+	cacheInvalidationSubscribeOnce sync.Once
+)
+
+func init() {
+	RegisterCacheInvalidationHandler(CacheInvalidationToken, func(key string) {
+		tokenLocalCache.Delete(fmt.Sprintf("token_enhanced:%s", key))
+	})
+	RegisterCacheInvalidationHandler(CacheInvalidationTokenId, func(key string) {
+		tokenLocalCache.Delete(getTokenEnhancedIdCacheKey(key))
+	})
+	RegisterCacheInvalidationHandler(CacheInvalidationUser, func(key string) {
+		userLocalCache.Delete(getUserCacheKey(key))
+	})
+	RegisterCacheInvalidationHandler(CacheInvalidationChannel, func(key string) {
+		InitChannelCache()
+	})
+	RegisterCacheInvalidationHandler(CacheInvalidationOption, func(key string) {
+		loadOptionsFromDatabase()
+	})
+	RegisterCacheInvalidationHandler(CacheInvalidationPricing, func(key string) {
+		updatePricingLock.Lock()
+		lastGetPricingTime = time.Time{}
+		updatePricingLock.Unlock()
+		modelUpstreamLimitCache.Clear()
+	})
+}
+
+// RegisterCacheInvalidationHandler 注册收到缓存失效事件时的处理函数，model 包之外的缓存（如模型倍率）在启动时注册
+func RegisterCacheInvalidationHandler(eventType string, handler func(key string)) {
+	cacheInvalidationHandlersLock.Lock()
+	defer cacheInvalidationHandlersLock.Unlock()
+	cacheInvalidationHandlers[eventType] = append(cacheInvalidationHandlers[eventType], handler)
+}
+
+// IsCacheInvalidationType 是否为支持的缓存失效事件类型
+func IsCacheInvalidationType(eventType string) bool {
+	return slices.Contains([]string{
+		CacheInvalidationToken,
+		CacheInvalidationTokenId,
+		CacheInvalidationUser,
+		CacheInvalidationChannel,
+		CacheInvalidationOption,
+		CacheInvalidationPricing,
+	}, eventType)
+}
+
+func handleCacheInvalidation(eventType string, key string) {
+	cacheInvalidationHandlersLock.RLock()
+	handlers := cacheInvalidationHandlers[eventType]
+	cacheInvalidationHandlersLock.RUnlock()
+	for _, handler := range handlers {
+		handler(key)
+	}
+}
+
+// PublishCacheInvalidation 通知其他节点清除缓存，本节点的缓存由调用方处理
+func PublishCacheInvalidation(eventType string, key string) {
+	if !common.RedisEnabled {
+		return
+	}
+	event := CacheInvalidationEvent{
+		Type: eventType,
+		Key:  key,
+		Node: cacheInvalidationNodeId,
+	}
+	gopool.Go(func() {
+		data, err := common.Marshal(event)
+		if err != nil {
+			return
+		}
+		if err := common.RDB.Publish(context.Background(), cacheInvalidationChannel, data).Err(); err != nil {
+			common.SysLog(fmt.Sprintf("failed to publish cache invalidation: type=%s, key=%s, error=%v", eventType, key, err))
+		}
+	})
+}
+
+// InvalidateCache 清除本节点的缓存并通知其他节点
+func InvalidateCache(eventType string, key string) {
+	handleCacheInvalidation(eventType, key)
+	PublishCacheInvalidation(eventType, key)
+}
+
+// StartCacheInvalidationSubscriber 订阅其他节点发布的缓存失效事件，连接断开后由 Redis 客户端自动重连
+func StartCacheInvalidationSubscriber() {
+	if !common.RedisEnabled {
+		return
+	}
+	cacheInvalidationSubscribeOnce.Do(func() {
+		pubsub := common.RDB.Subscribe(context.Background(), cacheInvalidationChannel)
+		gopool.Go(func() {
+			defer pubsub.Close()
+			for msg := range pubsub.Channel() {
+				var event CacheInvalidationEvent
+				if err := common.UnmarshalJsonStr(msg.Payload, &event); err != nil {
+					common.SysLog("invalid cache invalidation event: " + err.Error())
+					continue
+				}
+				if event.Node == cacheInvalidationNodeId {
+					continue
+				}
+				common.SysLog(fmt.Sprintf("cache invalidation received: type=%s, key=%s", event.Type, event.Key))
+				handleCacheInvalidation(event.Type, event.Key)
+			}
+		})
+		common.SysLog("cache invalidation subscriber started")
+	})
+}
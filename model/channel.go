@@ -149,11 +149,21 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	// 跳过冷却中的 key
+	enabledIdx = filterCoolingDownKeys(channel.Id, enabledIdx)
+	usable := make(map[int]bool, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		usable[idx] = true
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
-		// Randomly pick one enabled key
-		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
+		// Randomly pick one enabled key, weighted by key health
+		selectedIdx := channel.pickKeyByHealth(enabledIdx)
+		return keys[selectedIdx], selectedIdx, nil
+	case constant.MultiKeyModeLeastInflight, constant.MultiKeyModeUsageBalanced:
+		// Pick the enabled key with the fewest in-flight requests / lowest usage in the current window
+		selectedIdx := channel.pickKeyByLowestCount(enabledIdx)
 		return keys[selectedIdx], selectedIdx, nil
 	case constant.MultiKeyModePolling:
 		// Use channel-specific lock to ensure thread-safe polling
@@ -180,7 +190,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if usable[idx] {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -194,6 +204,27 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	}
 }
 
+// pickKeyByHealth 按各 key 的健康度加权随机选择，没有统计时等同于均匀随机
+func (channel *Channel) pickKeyByHealth(enabledIdx []int) int {
+	healthKeys := make([]string, len(enabledIdx))
+	for i, idx := range enabledIdx {
+		healthKeys[i] = channelHealthKey(channel.Id, idx)
+	}
+	factors := getChannelHealthFactors(healthKeys)
+	total := 0.0
+	for _, factor := range factors {
+		total += factor
+	}
+	r := rand.Float64() * total
+	for i, factor := range factors {
+		r -= factor
+		if r < 0 {
+			return enabledIdx[i]
+		}
+	}
+	return enabledIdx[len(enabledIdx)-1]
+}
+
 func (channel *Channel) SaveChannelInfo() error {
 	return DB.Model(channel).Update("channel_info", channel.ChannelInfo).Error
 }
@@ -326,10 +357,10 @@ func SearchChannels(keyword string, group string, model string, idSort bool) ([]
 			groupCondition = `(',' || ` + commonGroupCol + ` || ',') LIKE ?`
 		}
 		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
+		args = append(args, keyword, "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
 	} else {
 		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
+		args = append(args, keyword, "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
 	}
 
 	// 执行查询
@@ -371,6 +402,11 @@ func BatchInsertChannels(channels []Channel) error {
 		}
 	}()
 
+	for i := range channels {
+		if channels[i].Id == "" {
+			channels[i].Id = common.GetUUID()
+		}
+	}
 	for _, chunk := range lo.Chunk(channels, 50) {
 		if err := tx.Create(&chunk).Error; err != nil {
 			tx.Rollback()
@@ -386,7 +422,7 @@ func BatchInsertChannels(channels []Channel) error {
 	return tx.Commit().Error
 }
 
-func BatchDeleteChannels(ids []int) error {
+func BatchDeleteChannels(ids []string) error {
 	if len(ids) == 0 {
 		return nil
 	}
@@ -400,7 +436,7 @@ func BatchDeleteChannels(ids []int) error {
 			tx.Rollback()
 			return err
 		}
-		if err := tx.Where("channel_id in (?)", chunk).Delete(&Ability{}).Error; err != nil {
+		if err := tx.Table("t_abilities").Where("channel_id in (?)", chunk).Delete(&Ability{}).Error; err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -448,13 +484,23 @@ func (channel *Channel) GetStatusCodeMapping() string {
 }
 
 func (channel *Channel) Insert() error {
-	var err error
-	err = DB.Create(channel).Error
-	if err != nil {
+	if channel.Id == "" {
+		channel.Id = common.GetUUID()
+	}
+	// 渠道和能力表在同一事务中写入
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Create(channel).Error; err != nil {
+		tx.Rollback()
 		return err
 	}
-	err = channel.AddAbilities(nil)
-	return err
+	if err := channel.AddAbilities(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (channel *Channel) Update() error {
@@ -496,14 +542,24 @@ func (channel *Channel) Update() error {
 			}
 		}
 	}
-	var err error
-	err = DB.Model(channel).Updates(channel).Error
-	if err != nil {
+	// 渠道和能力表在同一事务中更新
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Model(channel).Updates(channel).Error; err != nil {
+		tx.Rollback()
 		return err
 	}
-	DB.Model(channel).First(channel, "id = ?", channel.Id)
-	err = channel.UpdateAbilities(nil)
-	return err
+	if err := tx.Model(channel).First(channel, "id = ?", channel.Id).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := channel.UpdateAbilities(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (channel *Channel) UpdateResponseTime(responseTime int64) {
@@ -527,13 +583,20 @@ func (channel *Channel) UpdateBalance(balance float64) {
 }
 
 func (channel *Channel) Delete() error {
-	var err error
-	err = DB.Delete(channel).Error
-	if err != nil {
+	// 渠道和能力表在同一事务中删除
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Delete(channel).Error; err != nil {
+		tx.Rollback()
 		return err
 	}
-	err = channel.DeleteAbilities()
-	return err
+	if err := tx.Table("t_abilities").Where("channel_id = ?", channel.Id).Delete(&Ability{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 var channelStatusLock sync.Mutex
@@ -584,29 +647,40 @@ func handlerMultiKeyUpdate(channel *Channel, usingKey string, status int, reason
 				break
 			}
 		}
-		if channel.ChannelInfo.MultiKeyStatusList == nil {
-			channel.ChannelInfo.MultiKeyStatusList = make(map[int]int)
+		setMultiKeyStatus(channel, keyIndex, status, reason)
+	}
+}
+
+// setMultiKeyStatus 更新多 key 渠道中指定 key 的状态，所有 key 都被禁用时渠道自动禁用
+func setMultiKeyStatus(channel *Channel, keyIndex int, status int, reason string) {
+	if channel.ChannelInfo.MultiKeyStatusList == nil {
+		channel.ChannelInfo.MultiKeyStatusList = make(map[int]int)
+	}
+	if status == common.ChannelStatusEnabled {
+		delete(channel.ChannelInfo.MultiKeyStatusList, keyIndex)
+		delete(channel.ChannelInfo.MultiKeyDisabledReason, keyIndex)
+		delete(channel.ChannelInfo.MultiKeyDisabledTime, keyIndex)
+		// 所有 key 被禁用导致渠道自动禁用时，有 key 恢复后渠道随之恢复
+		if channel.Status == common.ChannelStatusAutoDisabled && len(channel.ChannelInfo.MultiKeyStatusList) < channel.ChannelInfo.MultiKeySize {
+			channel.Status = common.ChannelStatusEnabled
 		}
-		if status == common.ChannelStatusEnabled {
-			delete(channel.ChannelInfo.MultiKeyStatusList, keyIndex)
-		} else {
-			channel.ChannelInfo.MultiKeyStatusList[keyIndex] = status
-			if channel.ChannelInfo.MultiKeyDisabledReason == nil {
-				channel.ChannelInfo.MultiKeyDisabledReason = make(map[int]string)
-			}
-			if channel.ChannelInfo.MultiKeyDisabledTime == nil {
-				channel.ChannelInfo.MultiKeyDisabledTime = make(map[int]int64)
-			}
-			channel.ChannelInfo.MultiKeyDisabledReason[keyIndex] = reason
-			channel.ChannelInfo.MultiKeyDisabledTime[keyIndex] = common.GetTimestamp()
+	} else {
+		channel.ChannelInfo.MultiKeyStatusList[keyIndex] = status
+		if channel.ChannelInfo.MultiKeyDisabledReason == nil {
+			channel.ChannelInfo.MultiKeyDisabledReason = make(map[int]string)
 		}
-		if len(channel.ChannelInfo.MultiKeyStatusList) >= channel.ChannelInfo.MultiKeySize {
-			channel.Status = common.ChannelStatusAutoDisabled
-			info := channel.GetOtherInfo()
-			info["status_reason"] = "All keys are disabled"
-			info["status_time"] = common.GetTimestamp()
-			channel.SetOtherInfo(info)
+		if channel.ChannelInfo.MultiKeyDisabledTime == nil {
+			channel.ChannelInfo.MultiKeyDisabledTime = make(map[int]int64)
 		}
+		channel.ChannelInfo.MultiKeyDisabledReason[keyIndex] = reason
+		channel.ChannelInfo.MultiKeyDisabledTime[keyIndex] = common.GetTimestamp()
+	}
+	if len(channel.ChannelInfo.MultiKeyStatusList) >= channel.ChannelInfo.MultiKeySize {
+		channel.Status = common.ChannelStatusAutoDisabled
+		info := channel.GetOtherInfo()
+		info["status_reason"] = "All keys are disabled"
+		info["status_time"] = common.GetTimestamp()
+		channel.SetOtherInfo(info)
 	}
 }
 
@@ -624,8 +698,12 @@ func UpdateChannelStatus(channelId string, usingKey string, status int, reason s
 			pollingLock := GetChannelPollingLock(channelId)
 			pollingLock.Lock()
 			// 如果是多Key模式，更新缓存中的状态
+			beforeStatus := channelCache.Status
 			handlerMultiKeyUpdate(channelCache, usingKey, status, reason)
 			pollingLock.Unlock()
+			if beforeStatus != channelCache.Status {
+				CacheUpdateChannelStatus(channelId, channelCache.Status)
+			}
 			//CacheUpdateChannel(channelCache)
 			//return true
 		} else {
@@ -638,9 +716,10 @@ func UpdateChannelStatus(channelId string, usingKey string, status int, reason s
 	}
 
 	shouldUpdateAbilities := false
+	abilityEnabled := status == common.ChannelStatusEnabled
 	defer func() {
 		if shouldUpdateAbilities {
-			err := UpdateAbilityStatus(channelId, status == common.ChannelStatusEnabled)
+			err := UpdateAbilityStatus(nil, channelId, abilityEnabled)
 			if err != nil {
 				common.SysLog(fmt.Sprintf("failed to update ability status: channel_id=%d, error=%v", channelId, err))
 			}
@@ -650,7 +729,8 @@ func UpdateChannelStatus(channelId string, usingKey string, status int, reason s
 	if err != nil {
 		return false
 	} else {
-		if channel.Status == status {
+		// 多 key 渠道按 key 更新状态，渠道本身状态不变时也需要继续处理
+		if !channel.ChannelInfo.IsMultiKey && channel.Status == status {
 			return false
 		}
 
@@ -663,6 +743,7 @@ func UpdateChannelStatus(channelId string, usingKey string, status int, reason s
 			pollingLock.Unlock()
 			if beforeStatus != channel.Status {
 				shouldUpdateAbilities = true
+				abilityEnabled = channel.Status == common.ChannelStatusEnabled
 			}
 		} else {
 			info := channel.GetOtherInfo()
@@ -678,25 +759,82 @@ func UpdateChannelStatus(channelId string, usingKey string, status int, reason s
 			return false
 		}
 	}
+	// 其他节点重新加载渠道缓存
+	PublishCacheInvalidation(CacheInvalidationChannel, channelId)
 	return true
 }
 
-func EnableChannelByTag(tag string) error {
-	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", common.ChannelStatusEnabled).Error
+var (
+	ErrChannelNotMultiKey        = errors.New("该渠道不是多 key 渠道")
+	ErrChannelKeyIndexOutOfRange = errors.New("key 下标超出范围")
+)
+
+// UpdateChannelKeyStatus 管理员按下标启用或禁用多 key 渠道中的 key，渠道状态变化时在同一事务中更新能力表。
+// 调用方负责刷新渠道缓存
+func UpdateChannelKeyStatus(channelId string, keyIndex int, status int, reason string) (*Channel, error) {
+	channelStatusLock.Lock()
+	defer channelStatusLock.Unlock()
+
+	channel, err := GetChannelById(channelId, true)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return nil, ErrChannelNotMultiKey
+	}
+	if keyIndex < 0 || keyIndex >= len(channel.GetKeys()) {
+		return nil, fmt.Errorf("%w: %d", ErrChannelKeyIndexOutOfRange, keyIndex)
+	}
+
+	beforeStatus := channel.Status
+	pollingLock := GetChannelPollingLock(channelId)
+	pollingLock.Lock()
+	setMultiKeyStatus(channel, keyIndex, status, reason)
+	pollingLock.Unlock()
+
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if err := tx.Omit("key").Save(channel).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if beforeStatus != channel.Status {
+		if err := UpdateAbilityStatus(tx, channelId, channel.Status == common.ChannelStatusEnabled); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
 	}
-	err = UpdateAbilityStatusByTag(tag, true)
-	return err
+	return channel, nil
+}
+
+func EnableChannelByTag(tag string) error {
+	return updateChannelStatusByTag(tag, common.ChannelStatusEnabled)
 }
 
 func DisableChannelByTag(tag string) error {
-	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", common.ChannelStatusManuallyDisabled).Error
-	if err != nil {
+	return updateChannelStatusByTag(tag, common.ChannelStatusManuallyDisabled)
+}
+
+// updateChannelStatusByTag 在同一事务中更新标签下所有渠道和能力表的状态
+func updateChannelStatusByTag(tag string, status int) error {
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Model(&Channel{}).Where("tag = ?", tag).Update("status", status).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := UpdateAbilityStatusByTag(tx, tag, status == common.ChannelStatusEnabled); err != nil {
+		tx.Rollback()
 		return err
 	}
-	err = UpdateAbilityStatusByTag(tag, false)
-	return err
+	return tx.Commit().Error
 }
 
 func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *string, group *string, priority *int64, weight *uint, paramOverride *string, headerOverride *string) error {
@@ -732,27 +870,35 @@ func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *
 		updateData.HeaderOverride = headerOverride
 	}
 
-	err := DB.Model(&Channel{}).Where("tag = ?", tag).Updates(updateData).Error
-	if err != nil {
+	// 渠道和能力表在同一事务中更新
+	tx := DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Model(&Channel{}).Where("tag = ?", tag).Updates(updateData).Error; err != nil {
+		tx.Rollback()
 		return err
 	}
 	if shouldReCreateAbilities {
-		channels, err := GetChannelsByTag(updatedTag, false, false)
-		if err == nil {
-			for _, channel := range channels {
-				err = channel.UpdateAbilities(nil)
-				if err != nil {
-					common.SysLog(fmt.Sprintf("failed to update abilities: channel_id=%d, tag=%s, error=%v", channel.Id, channel.GetTag(), err))
-				}
+		var channels []*Channel
+		if err := tx.Omit("key").Where("tag = ?", updatedTag).Find(&channels).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		for _, channel := range channels {
+			if err := channel.UpdateAbilities(tx); err != nil {
+				common.SysLog(fmt.Sprintf("failed to update abilities: channel_id=%s, tag=%s, error=%v", channel.Id, channel.GetTag(), err))
+				tx.Rollback()
+				return err
 			}
 		}
 	} else {
-		err := UpdateAbilityByTag(tag, newTag, priority, weight)
-		if err != nil {
+		if err := UpdateAbilityByTag(tx, tag, newTag, priority, weight); err != nil {
+			tx.Rollback()
 			return err
 		}
 	}
-	return nil
+	return tx.Commit().Error
 }
 
 func UpdateChannelUsedQuota(id string, quota int) {
@@ -821,10 +967,10 @@ func SearchTags(keyword string, group string, model string, idSort bool) ([]*str
 			groupCondition = `(',' || ` + commonGroupCol + ` || ',') LIKE ?`
 		}
 		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + ` LIKE ? AND ` + groupCondition
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
+		args = append(args, keyword, "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%", "%,"+group+",%")
 	} else {
 		whereClause = "(id = ? OR name LIKE ? OR " + commonKeyCol + " = ? OR " + baseURLCol + " LIKE ?) AND " + modelsCol + " LIKE ?"
-		args = append(args, common.String2Int(keyword), "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
+		args = append(args, keyword, "%"+keyword+"%", keyword, "%"+keyword+"%", "%"+model+"%")
 	}
 
 	subQuery := baseQuery.Where(whereClause, args...).
@@ -851,6 +997,30 @@ func (channel *Channel) ValidateSettings() error {
 			return err
 		}
 	}
+	if channelParams.MaxConcurrency < 0 || channelParams.UpstreamRpm < 0 || channelParams.UpstreamTpm < 0 {
+		return errors.New("max_concurrency、upstream_rpm、upstream_tpm 不能为负数")
+	}
+	for modelName, limit := range channelParams.UpstreamModelLimits {
+		if limit.Rpm < 0 || limit.Tpm < 0 {
+			return fmt.Errorf("upstream_model_limits 中模型 %s 的 rpm、tpm 不能为负数", modelName)
+		}
+	}
+	// 模型重定向、参数覆盖、请求头覆盖需为 JSON 对象
+	if mapping := channel.GetModelMapping(); mapping != "" {
+		if err := common.UnmarshalJsonStr(mapping, &map[string]string{}); err != nil {
+			return fmt.Errorf("model_mapping 格式错误: %v", err)
+		}
+	}
+	for name, value := range map[string]*string{
+		"param_override":  channel.ParamOverride,
+		"header_override": channel.HeaderOverride,
+	} {
+		if value != nil && *value != "" {
+			if err := common.UnmarshalJsonStr(*value, &map[string]interface{}{}); err != nil {
+				return fmt.Errorf("%s 格式错误: %v", name, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -920,13 +1090,13 @@ func (channel *Channel) GetHeaderOverride() map[string]interface{} {
 	return headerOverride
 }
 
-func GetChannelsByIds(ids []int) ([]*Channel, error) {
+func GetChannelsByIds(ids []string) ([]*Channel, error) {
 	var channels []*Channel
 	err := DB.Where("id in (?)", ids).Find(&channels).Error
 	return channels, err
 }
 
-func BatchSetChannelTag(ids []int, tag *string) error {
+func BatchSetChannelTag(ids []string, tag *string) error {
 	// 开启事务
 	tx := DB.Begin()
 	if tx.Error != nil {
@@ -940,8 +1110,9 @@ func BatchSetChannelTag(ids []int, tag *string) error {
 		return err
 	}
 
-	// update ability status
-	channels, err := GetChannelsByIds(ids)
+	// update ability status，在事务内读取，能力表使用更新后的标签
+	var channels []*Channel
+	err = tx.Where("id in (?)", ids).Find(&channels).Error
 	if err != nil {
 		tx.Rollback()
 		return err
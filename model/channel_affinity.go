@@ -0,0 +1,110 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/setting/ratio_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 会话亲和：同一会话的请求优先路由到上次成功的渠道和 key，提高上游提示词缓存的命中率。
+// 映射在请求成功后写入，启用 Redis 时各节点共享，否则保存在本节点内存中，超过 CHANNEL_AFFINITY_TTL 未使用后失效
+
+// 亲和渠道的健康度系数低于该值时视为不健康，回退到正常选择
+const channelAffinityMinHealthFactor = 0.5
+
+// ChannelAffinity 会话亲和的目标渠道
+type ChannelAffinity struct {
+	Group     string `json:"group"`
+	ChannelId string `json:"channel_id"`
+	KeyIndex  int    `json:"key_index"` // 非多 key 渠道为 -1
+}
+
+var channelAffinityCache = common.NewLocalCache(10 * time.Minute)
+
+func channelAffinityCacheKey(affinityKey string) string {
+	return "channel_affinity:" + affinityKey
+}
+
+func channelAffinityTTL() time.Duration {
+	if constant.ChannelAffinityTTLSeconds <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(constant.ChannelAffinityTTLSeconds) * time.Second
+}
+
+// GetChannelAffinity 读取会话亲和的目标渠道，不存在时返回 nil
+func GetChannelAffinity(affinityKey string) *ChannelAffinity {
+	if common.RedisEnabled {
+		var affinity ChannelAffinity
+		if err := common.RedisGetJSON(channelAffinityCacheKey(affinityKey), &affinity); err != nil {
+			return nil
+		}
+		return &affinity
+	}
+	if cached, ok := channelAffinityCache.Get(affinityKey); ok {
+		affinity := cached.(ChannelAffinity)
+		return &affinity
+	}
+	return nil
+}
+
+// SetChannelAffinity 写入会话亲和的目标渠道并刷新过期时间
+func SetChannelAffinity(affinityKey string, affinity ChannelAffinity) {
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := common.RedisSetJSON(channelAffinityCacheKey(affinityKey), affinity, channelAffinityTTL()); err != nil {
+				common.SysLog(fmt.Sprintf("failed to set channel affinity: channel_id=%s, error=%v", affinity.ChannelId, err))
+			}
+		})
+		return
+	}
+	channelAffinityCache.SetWithTTL(affinityKey, affinity, channelAffinityTTL())
+}
+
+// IsChannelAffinityAvailable 亲和渠道是否仍可服务该分组和模型：渠道已启用、未熔断、未冷却、并发未满且健康度不低于阈值
+func IsChannelAffinityAvailable(group string, modelName string, channelId string) bool {
+	if !IsChannelBreakerAvailable(channelId, modelName) || isChannelCoolingDown(channelId) || isChannelConcurrencySaturated(channelId) {
+		return false
+	}
+	if getChannelHealthFactors([]string{channelHealthKey(channelId, -1)})[0] < channelAffinityMinHealthFactor {
+		return false
+	}
+
+	if !common.MemoryCacheEnabled {
+		var count int64
+		DB.Table("t_abilities").Where(commonGroupCol+" = ? and model = ? and channel_id = ? and enabled = ?", group, modelName, channelId, true).Count(&count)
+		return count > 0
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	channels := group2model2channels[group][modelName]
+	if len(channels) == 0 {
+		channels = group2model2channels[group][ratio_setting.FormatMatchingModelName(modelName)]
+	}
+	for _, id := range channels {
+		if id == channelId {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEnabledKeyByIndex 获取多 key 渠道指定下标的 key，key 未启用或在冷却中时返回 false
+func (channel *Channel) GetEnabledKeyByIndex(keyIndex int) (string, bool) {
+	keys := channel.GetKeys()
+	if keyIndex < 0 || keyIndex >= len(keys) {
+		return "", false
+	}
+	if status, ok := channel.ChannelInfo.MultiKeyStatusList[keyIndex]; ok && status != common.ChannelStatusEnabled {
+		return "", false
+	}
+	if isChannelKeyCoolingDown(channel.Id, keyIndex) {
+		return "", false
+	}
+	return keys[keyIndex], true
+}
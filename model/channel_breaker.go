@@ -0,0 +1,210 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+)
+
+// 渠道熔断：按 渠道+模型 统计连续失败，达到阈值后熔断（open），熔断期间选择渠道和重试时跳过；
+// 熔断时间结束后进入半开（half_open），只放行少量试探请求，试探成功则恢复（closed），失败则重新熔断。
+// 熔断状态只在本节点内存中维护，各节点独立判断
+
+const (
+	ChannelBreakerStateClosed   = "closed"
+	ChannelBreakerStateOpen     = "open"
+	ChannelBreakerStateHalfOpen = "half_open"
+)
+
+// ChannelBreaker 渠道+模型的熔断状态
+type ChannelBreaker struct {
+	ChannelId           string     `json:"channel_id"`
+	Model               string     `json:"model"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"` // 熔断结束时间，之后进入半开
+	LastError           string     `json:"last_error,omitempty"`
+	trialsInFlight      int
+	lastTrialAt         time.Time
+}
+
+var (
+	channelBreakers     = make(map[string]*ChannelBreaker)
+	channelBreakersLock sync.Mutex
+)
+
+func channelBreakerKey(channelId string, modelName string) string {
+	return channelId + "|" + modelName
+}
+
+func channelBreakerOpenDuration() time.Duration {
+	return time.Duration(constant.ChannelBreakerOpenSeconds) * time.Second
+}
+
+// refresh 熔断时间结束后转为半开；长时间没有结果的试探请求视为已结束，调用方需持有锁
+func (b *ChannelBreaker) refresh(now time.Time) {
+	if b.State == ChannelBreakerStateOpen && b.OpenUntil != nil && !now.Before(*b.OpenUntil) {
+		b.setState(ChannelBreakerStateHalfOpen)
+		b.trialsInFlight = 0
+	}
+	if b.State == ChannelBreakerStateHalfOpen && b.trialsInFlight > 0 && now.Sub(b.lastTrialAt) > channelBreakerOpenDuration() {
+		b.trialsInFlight = 0
+	}
+}
+
+func (b *ChannelBreaker) setState(state string) {
+	if b.State == state {
+		return
+	}
+	common.SysLog(fmt.Sprintf("channel breaker state changed: channel_id=%s, model=%s, %s -> %s, consecutive_failures=%d, last_error=%s",
+		b.ChannelId, b.Model, b.State, state, b.ConsecutiveFailures, b.LastError))
+	b.State = state
+}
+
+// isAvailable 熔断器是否允许新的请求，调用方需持有锁
+func (b *ChannelBreaker) isAvailable(now time.Time) bool {
+	b.refresh(now)
+	switch b.State {
+	case ChannelBreakerStateOpen:
+		return false
+	case ChannelBreakerStateHalfOpen:
+		return b.trialsInFlight < constant.ChannelBreakerHalfOpenRequests
+	}
+	return true
+}
+
+// IsChannelBreakerAvailable 渠道+模型未熔断（或半开且还有试探名额）时返回 true
+func IsChannelBreakerAvailable(channelId string, modelName string) bool {
+	if !constant.ChannelBreakerEnabled {
+		return true
+	}
+	channelBreakersLock.Lock()
+	defer channelBreakersLock.Unlock()
+	b, ok := channelBreakers[channelBreakerKey(channelId, modelName)]
+	if !ok {
+		return true
+	}
+	return b.isAvailable(time.Now())
+}
+
+// filterChannelBreakers 过滤掉已熔断的渠道，不修改原切片
+func filterChannelBreakers(channelIds []string, modelName string) []string {
+	if !constant.ChannelBreakerEnabled {
+		return channelIds
+	}
+	channelBreakersLock.Lock()
+	defer channelBreakersLock.Unlock()
+	if len(channelBreakers) == 0 {
+		return channelIds
+	}
+	now := time.Now()
+	available := make([]string, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		if b, ok := channelBreakers[channelBreakerKey(channelId, modelName)]; ok && !b.isAvailable(now) {
+			continue
+		}
+		available = append(available, channelId)
+	}
+	return available
+}
+
+// AcquireChannelBreaker 选中渠道后调用，半开状态下占用一个试探名额
+func AcquireChannelBreaker(channelId string, modelName string) {
+	if !constant.ChannelBreakerEnabled {
+		return
+	}
+	channelBreakersLock.Lock()
+	defer channelBreakersLock.Unlock()
+	b, ok := channelBreakers[channelBreakerKey(channelId, modelName)]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	b.refresh(now)
+	if b.State == ChannelBreakerStateHalfOpen {
+		b.trialsInFlight++
+		b.lastTrialAt = now
+	}
+}
+
+// RecordChannelBreakerResult 记录渠道+模型一次请求的结果，success 为 false 表示上游故障
+func RecordChannelBreakerResult(channelId string, modelName string, success bool, errMsg string) {
+	if !constant.ChannelBreakerEnabled || channelId == "" {
+		return
+	}
+	key := channelBreakerKey(channelId, modelName)
+	channelBreakersLock.Lock()
+	defer channelBreakersLock.Unlock()
+	b, ok := channelBreakers[key]
+	if !ok {
+		if success {
+			return
+		}
+		b = &ChannelBreaker{ChannelId: channelId, Model: modelName, State: ChannelBreakerStateClosed}
+		channelBreakers[key] = b
+	}
+	now := time.Now()
+	b.refresh(now)
+	if b.State == ChannelBreakerStateHalfOpen && b.trialsInFlight > 0 {
+		b.trialsInFlight--
+	}
+
+	if success {
+		b.ConsecutiveFailures = 0
+		b.setState(ChannelBreakerStateClosed)
+		// 恢复后不再保留记录
+		delete(channelBreakers, key)
+		return
+	}
+
+	b.ConsecutiveFailures++
+	b.LastError = errMsg
+	if b.State == ChannelBreakerStateHalfOpen || b.ConsecutiveFailures >= constant.ChannelBreakerFailureThreshold {
+		openUntil := now.Add(channelBreakerOpenDuration())
+		b.OpenedAt = &now
+		b.OpenUntil = &openUntil
+		b.trialsInFlight = 0
+		b.setState(ChannelBreakerStateOpen)
+	}
+}
+
+// GetChannelBreakers 获取所有存在失败记录的熔断器，按渠道、模型排序
+func GetChannelBreakers() []ChannelBreaker {
+	channelBreakersLock.Lock()
+	defer channelBreakersLock.Unlock()
+	now := time.Now()
+	breakers := make([]ChannelBreaker, 0, len(channelBreakers))
+	for _, b := range channelBreakers {
+		b.refresh(now)
+		breakers = append(breakers, *b)
+	}
+	sort.Slice(breakers, func(i, j int) bool {
+		if breakers[i].ChannelId != breakers[j].ChannelId {
+			return breakers[i].ChannelId < breakers[j].ChannelId
+		}
+		return breakers[i].Model < breakers[j].Model
+	})
+	return breakers
+}
+
+// ResetChannelBreakers 手动恢复熔断器，modelName 为空时恢复该渠道的所有模型，返回恢复的数量
+func ResetChannelBreakers(channelId string, modelName string) int {
+	channelBreakersLock.Lock()
+	defer channelBreakersLock.Unlock()
+	count := 0
+	for key, b := range channelBreakers {
+		if b.ChannelId != channelId || (modelName != "" && b.Model != modelName) {
+			continue
+		}
+		b.ConsecutiveFailures = 0
+		b.setState(ChannelBreakerStateClosed)
+		delete(channelBreakers, key)
+		count++
+	}
+	return count
+}
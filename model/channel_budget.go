@@ -0,0 +1,190 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/dto"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道上游预算：按渠道（以及渠道+模型）声明上游账号的 RPM、TPM，使用每分钟补满的令牌桶跟踪消耗。
+// 请求开始时按预估的提示 token 扣减，计费时按实际 token 数校正；剩余预算低于阈值的渠道在选择时降低权重，
+// 在上游限流之前把流量分散到其他渠道。启用 Redis 时令牌桶在 Redis 中原子更新，各节点共享
+
+// 预算耗尽时权重系数的下限
+const channelBudgetMinFactor = 0.01
+
+const channelBudgetRedisTTL = 2 * time.Minute
+
+type channelBudgetBucket struct {
+	capacity  float64 // 每分钟额度，也是桶容量
+	level     float64 // 当前剩余，可能为负数（实际用量超出预估）
+	updatedAt time.Time
+}
+
+var (
+	channelBudgetBuckets     = make(map[string]*channelBudgetBucket)
+	channelBudgetBucketsLock sync.Mutex
+
+	// 模型表中的上游限制，model name -> dto.UpstreamLimit
+	modelUpstreamLimitCache = common.NewLocalCache(5 * time.Minute)
+)
+
+// channelBudgetScript 在 Redis 中原子补充并扣减令牌桶，返回扣减后的剩余
+var channelBudgetScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local v = redis.call('HMGET', KEYS[1], 'level', 'ts')
+local level = tonumber(v[1]) or capacity
+local ts = tonumber(v[2]) or now
+if now > ts then
+	level = math.min(capacity, level + (now - ts) * capacity / 60000)
+end
+level = math.min(capacity, level - cost)
+redis.call('HSET', KEYS[1], 'level', tostring(level), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return tostring(level)
+`)
+
+func channelBudgetKey(channelId string, modelName string, kind string) string {
+	return fmt.Sprintf("%s|%s|%s", channelId, modelName, kind)
+}
+
+func channelBudgetCacheKey(key string) string {
+	return "channel_budget:" + key
+}
+
+// refill 按经过的时间补充令牌，调用方需持有锁
+func (b *channelBudgetBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.level = math.Min(b.capacity, b.level+elapsed*b.capacity/60)
+	b.updatedAt = now
+}
+
+// getModelUpstreamLimit 读取模型表中的上游限制，结果在本地缓存 5 分钟
+func getModelUpstreamLimit(modelName string) dto.UpstreamLimit {
+	if cached, ok := modelUpstreamLimitCache.Get(modelName); ok {
+		return cached.(dto.UpstreamLimit)
+	}
+	var m Model
+	limit := dto.UpstreamLimit{}
+	if err := DB.Model(&Model{}).Select("rpm_limit", "tpm_limit").Where("model_name = ?", modelName).First(&m).Error; err == nil {
+		limit.Rpm, limit.Tpm = m.RpmLimit, m.TpmLimit
+	}
+	modelUpstreamLimitCache.Set(modelName, limit)
+	return limit
+}
+
+// consumeChannelBudgetBucket 扣减令牌桶，capacity 为 0 表示不限制；cost 为负数时返还
+func consumeChannelBudgetBucket(key string, capacity int, cost float64) {
+	if capacity <= 0 || cost == 0 {
+		return
+	}
+	now := time.Now()
+	channelBudgetBucketsLock.Lock()
+	b, ok := channelBudgetBuckets[key]
+	if !ok {
+		b = &channelBudgetBucket{level: float64(capacity), updatedAt: now}
+		channelBudgetBuckets[key] = b
+	}
+	b.capacity = float64(capacity)
+	b.refill(now)
+	b.level = math.Min(b.capacity, b.level-cost)
+	channelBudgetBucketsLock.Unlock()
+
+	if !common.RedisEnabled {
+		return
+	}
+	gopool.Go(func() {
+		result, err := channelBudgetScript.Run(context.Background(), common.RDB, []string{channelBudgetCacheKey(key)},
+			capacity, cost, now.UnixMilli(), channelBudgetRedisTTL.Milliseconds()).Result()
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to update channel budget: key=%s, error=%v", key, err))
+			return
+		}
+		s, _ := result.(string)
+		level, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return
+		}
+		// 以 Redis 中各节点合并后的剩余为准
+		channelBudgetBucketsLock.Lock()
+		if b, ok := channelBudgetBuckets[key]; ok {
+			b.level = level
+			b.updatedAt = now
+		}
+		channelBudgetBucketsLock.Unlock()
+	})
+}
+
+// ConsumeChannelBudget 请求开始时扣减渠道和渠道+模型的 RPM、TPM 预算，promptTokens 为预估的提示 token 数
+func ConsumeChannelBudget(channelId string, modelName string, setting dto.ChannelSettings, promptTokens int) {
+	consumeChannelBudgetBucket(channelBudgetKey(channelId, "", "rpm"), setting.UpstreamRpm, 1)
+	consumeChannelBudgetBucket(channelBudgetKey(channelId, "", "tpm"), setting.UpstreamTpm, float64(promptTokens))
+
+	modelLimit, ok := setting.UpstreamModelLimits[modelName]
+	if !ok {
+		modelLimit = getModelUpstreamLimit(modelName)
+	}
+	consumeChannelBudgetBucket(channelBudgetKey(channelId, modelName, "rpm"), modelLimit.Rpm, 1)
+	consumeChannelBudgetBucket(channelBudgetKey(channelId, modelName, "tpm"), modelLimit.Tpm, float64(promptTokens))
+}
+
+// ReconcileChannelBudget 计费时按实际 token 数校正 TPM 预算，只处理已有令牌桶的渠道
+func ReconcileChannelBudget(channelId string, modelName string, estimatedTokens int, actualTokens int) {
+	if actualTokens <= 0 || actualTokens == estimatedTokens {
+		return
+	}
+	for _, key := range []string{channelBudgetKey(channelId, "", "tpm"), channelBudgetKey(channelId, modelName, "tpm")} {
+		channelBudgetBucketsLock.Lock()
+		b, ok := channelBudgetBuckets[key]
+		capacity := 0
+		if ok {
+			capacity = int(b.capacity)
+		}
+		channelBudgetBucketsLock.Unlock()
+		consumeChannelBudgetBucket(key, capacity, float64(actualTokens-estimatedTokens))
+	}
+}
+
+// getChannelBudgetFactor 渠道剩余预算对应的权重系数：剩余比例低于 CHANNEL_BUDGET_SOFT_THRESHOLD 后线性降低
+func getChannelBudgetFactor(channelId string, modelName string) float64 {
+	channelBudgetBucketsLock.Lock()
+	defer channelBudgetBucketsLock.Unlock()
+	if len(channelBudgetBuckets) == 0 {
+		return 1
+	}
+	threshold := constant.ChannelBudgetSoftThreshold
+	now := time.Now()
+	factor := 1.0
+	for _, key := range []string{
+		channelBudgetKey(channelId, "", "rpm"),
+		channelBudgetKey(channelId, "", "tpm"),
+		channelBudgetKey(channelId, modelName, "rpm"),
+		channelBudgetKey(channelId, modelName, "tpm"),
+	} {
+		b, ok := channelBudgetBuckets[key]
+		if !ok || b.capacity <= 0 {
+			continue
+		}
+		b.refill(now)
+		remaining := b.level / b.capacity
+		if threshold > 0 && remaining < threshold {
+			factor = math.Min(factor, math.Max(channelBudgetMinFactor, remaining/threshold))
+		}
+	}
+	return factor
+}
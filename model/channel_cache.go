@@ -115,6 +115,17 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, nil
 	}
 
+	// 跳过已熔断的渠道
+	channels = filterChannelBreakers(channels, model)
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("分组 %s 下模型 %s 的渠道均已熔断，请稍后再试", group, model)
+	}
+	// 跳过所有 key 都在冷却的多 key 渠道
+	channels = filterCoolingDownChannels(channels)
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("分组 %s 下模型 %s 的渠道均已限流，请稍后再试", group, model)
+	}
+
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
 			return channel, nil
@@ -142,12 +153,10 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	targetPriority := int64(sortedUniquePriorities[retry])
 
 	// get the priority for the given retry number
-	var sumWeight = 0
 	var targetChannels []*Channel
 	for _, channelId := range channels {
 		if channel, ok := channelsIDM[channelId]; ok {
 			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
 				targetChannels = append(targetChannels, channel)
 			}
 		} else {
@@ -158,36 +167,75 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	if len(targetChannels) == 0 {
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
+	// 优先选择同一优先级内并发未满的渠道
+	targetChannels = filterSaturatedChannels(targetChannels)
+	weights := channelSelectionWeights(targetChannels, model).Weights
+	totalWeight := 0.0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+
+	// Generate a random value in the range [0, totalWeight)
+	randomWeight := rand.Float64() * totalWeight
+
+	// Find a channel based on its weight
+	for i, channel := range targetChannels {
+		randomWeight -= weights[i]
+		if randomWeight < 0 {
+			return channel, nil
+		}
+	}
+	// 浮点误差兜底
+	if totalWeight > 0 {
+		return targetChannels[len(targetChannels)-1], nil
+	}
+	// return null if no channel is not found
+	return nil, errors.New("channel not found")
+}
+
+// channelWeights 同一优先级内各渠道的有效权重及其组成
+type channelWeights struct {
+	Weights       []float64
+	HealthFactors []float64
+	BudgetFactors []float64
+}
+
+// channelSelectionWeights 计算同一优先级内各渠道的有效权重：配置的权重经平滑后，按健康度和上游预算缩放
+func channelSelectionWeights(channels []*Channel, model string) channelWeights {
+	sumWeight := 0
+	for _, channel := range channels {
+		sumWeight += channel.GetWeight()
+	}
 
 	// smoothing factor and adjustment
 	smoothingFactor := 1
 	smoothingAdjustment := 0
 
 	if sumWeight == 0 {
-		// when all channels have weight 0, set sumWeight to the number of channels and set smoothing adjustment to 100
+		// when all channels have weight 0, set smoothing adjustment to 100
 		// each channel's effective weight = 100
-		sumWeight = len(targetChannels) * 100
 		smoothingAdjustment = 100
-	} else if sumWeight/len(targetChannels) < 10 {
+	} else if sumWeight/len(channels) < 10 {
 		// when the average weight is less than 10, set smoothing factor to 100
 		smoothingFactor = 100
 	}
 
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := sumWeight * smoothingFactor
-
-	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
-		if randomWeight < 0 {
-			return channel, nil
-		}
+	// 按健康度缩放每个渠道的有效权重
+	healthKeys := make([]string, len(channels))
+	for i, channel := range channels {
+		healthKeys[i] = channelHealthKey(channel.Id, -1)
 	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	result := channelWeights{
+		Weights:       make([]float64, len(channels)),
+		HealthFactors: getChannelHealthFactors(healthKeys),
+		BudgetFactors: make([]float64, len(channels)),
+	}
+	for i, channel := range channels {
+		// 接近上游 RPM、TPM 限制的渠道降低权重
+		result.BudgetFactors[i] = getChannelBudgetFactor(channel.Id, model)
+		result.Weights[i] = float64(channel.GetWeight()*smoothingFactor+smoothingAdjustment) * result.HealthFactors[i] * result.BudgetFactors[i]
+	}
+	return result
 }
 
 func CacheGetChannel(id string) (*Channel, error) {
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"relay-gateway/constant"
+)
+
+// 渠道并发限制：渠道设置了 max_concurrency 时，请求期间占用一个并发名额；
+// 名额用完后新请求在有界队列中按先后顺序等待，超过等待时间或队列已满时返回错误，由重试切换到其他渠道。
+// 选择渠道时跳过同一优先级内已满的渠道。并发计数只在本节点内存中维护，每个节点独立限制
+
+var (
+	ErrChannelConcurrencyQueueFull   = errors.New("渠道并发已满，等待队列已满")
+	ErrChannelConcurrencyWaitTimeout = errors.New("渠道并发已满，等待超时")
+)
+
+type channelConcurrencyLimiter struct {
+	limit    int
+	inflight int
+	waiters  []chan struct{} // 等待队列，先进先出
+
+	// 统计
+	totalWaits    int64
+	totalRejected int64
+	totalWaitTime time.Duration
+	maxQueueDepth int
+}
+
+// ChannelConcurrencyStats 渠道并发统计
+type ChannelConcurrencyStats struct {
+	ChannelId     string `json:"channel_id"`
+	Limit         int    `json:"limit"`
+	Inflight      int    `json:"inflight"`
+	QueueDepth    int    `json:"queue_depth"`
+	MaxQueueDepth int    `json:"max_queue_depth"` // 启动以来的最大排队数
+	TotalWaits    int64  `json:"total_waits"`     // 排队等待过的请求数
+	TotalRejected int64  `json:"total_rejected"`  // 队列已满或等待超时的请求数
+	AvgWaitMs     int64  `json:"avg_wait_ms"`     // 排队请求的平均等待时间
+}
+
+var (
+	channelConcurrencyLimiters     = make(map[string]*channelConcurrencyLimiter)
+	channelConcurrencyLimitersLock sync.Mutex
+)
+
+// AcquireChannelConcurrency 占用渠道的一个并发名额，limit 为 0 时不限制。
+// 名额已满时排队等待，返回的 release 必须在请求结束后调用
+func AcquireChannelConcurrency(ctx context.Context, channelId string, limit int) (release func(), err error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+	channelConcurrencyLimitersLock.Lock()
+	l, ok := channelConcurrencyLimiters[channelId]
+	if !ok {
+		l = &channelConcurrencyLimiter{}
+		channelConcurrencyLimiters[channelId] = l
+	}
+	l.limit = limit
+	release = func() {
+		releaseChannelConcurrency(channelId)
+	}
+	if l.inflight < l.limit && len(l.waiters) == 0 {
+		l.inflight++
+		channelConcurrencyLimitersLock.Unlock()
+		return release, nil
+	}
+	if len(l.waiters) >= constant.ChannelConcurrencyQueueSize {
+		l.totalRejected++
+		channelConcurrencyLimitersLock.Unlock()
+		return nil, ErrChannelConcurrencyQueueFull
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.totalWaits++
+	l.maxQueueDepth = max(l.maxQueueDepth, len(l.waiters))
+	channelConcurrencyLimitersLock.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(time.Duration(constant.ChannelConcurrencyWaitTimeoutSeconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		channelConcurrencyLimitersLock.Lock()
+		l.totalWaitTime += time.Since(start)
+		channelConcurrencyLimitersLock.Unlock()
+		return release, nil
+	case <-timer.C:
+		err = ErrChannelConcurrencyWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	channelConcurrencyLimitersLock.Lock()
+	defer channelConcurrencyLimitersLock.Unlock()
+	l.totalWaitTime += time.Since(start)
+	for i, waiter := range l.waiters {
+		if waiter == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			l.totalRejected++
+			return nil, err
+		}
+	}
+	// 超时的同时已被唤醒，名额已转交给当前请求
+	return release, nil
+}
+
+// releaseChannelConcurrency 释放名额，有排队请求时直接转交给队首
+func releaseChannelConcurrency(channelId string) {
+	channelConcurrencyLimitersLock.Lock()
+	defer channelConcurrencyLimitersLock.Unlock()
+	l, ok := channelConcurrencyLimiters[channelId]
+	if !ok {
+		return
+	}
+	// 限制调小后，超出的名额释放时不再转交
+	if len(l.waiters) > 0 && l.inflight <= l.limit {
+		ready := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		close(ready)
+		return
+	}
+	l.inflight--
+}
+
+// isChannelConcurrencySaturated 渠道并发名额是否已用完
+func isChannelConcurrencySaturated(channelId string) bool {
+	channelConcurrencyLimitersLock.Lock()
+	defer channelConcurrencyLimitersLock.Unlock()
+	l, ok := channelConcurrencyLimiters[channelId]
+	return ok && l.limit > 0 && l.inflight >= l.limit
+}
+
+// filterSaturatedChannels 过滤掉并发已满的渠道，全部已满时返回原列表（请求将排队等待）
+func filterSaturatedChannels(channels []*Channel) []*Channel {
+	available := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !isChannelConcurrencySaturated(channel.Id) {
+			available = append(available, channel)
+		}
+	}
+	if len(available) == 0 {
+		return channels
+	}
+	return available
+}
+
+// GetChannelConcurrencyStats 获取本节点各渠道的并发和排队统计，按渠道 id 排序
+func GetChannelConcurrencyStats() []ChannelConcurrencyStats {
+	channelConcurrencyLimitersLock.Lock()
+	defer channelConcurrencyLimitersLock.Unlock()
+	stats := make([]ChannelConcurrencyStats, 0, len(channelConcurrencyLimiters))
+	for channelId, l := range channelConcurrencyLimiters {
+		s := ChannelConcurrencyStats{
+			ChannelId:     channelId,
+			Limit:         l.limit,
+			Inflight:      l.inflight,
+			QueueDepth:    len(l.waiters),
+			MaxQueueDepth: l.maxQueueDepth,
+			TotalWaits:    l.totalWaits,
+			TotalRejected: l.totalRejected,
+		}
+		if l.totalWaits > 0 {
+			s.AvgWaitMs = l.totalWaitTime.Milliseconds() / l.totalWaits
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ChannelId < stats[j].ChannelId
+	})
+	return stats
+}
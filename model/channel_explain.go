@@ -0,0 +1,264 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"relay-gateway/common"
+	"relay-gateway/setting/ratio_setting"
+)
+
+// 渠道路由诊断：按与 GetRandomSatisfiedChannel 相同的规则列出分组+模型的各优先级候选渠道、有效权重和选中概率，
+// 以及被排除的渠道和原因。只读取本节点的缓存和状态，不发送上游请求，也不占用熔断的试探名额
+
+// 渠道被排除的原因
+const (
+	ChannelExcludeDisabled    = "disabled"     // 渠道已禁用
+	ChannelExcludeBreakerOpen = "breaker_open" // 该模型已熔断
+	ChannelExcludeCoolingDown = "cooling_down" // 多 key 渠道所有 key 都在冷却
+	ChannelExcludeSaturated   = "saturated"    // 并发已满，同一优先级内有并发未满的渠道
+	ChannelExcludeNotFound    = "not_found"    // 能力表中存在但渠道缓存中不存在
+)
+
+// ChannelRouteKey 多 key 渠道中不可用的 key
+type ChannelRouteKey struct {
+	Index       int    `json:"index"`
+	Status      int    `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	CoolingDown bool   `json:"cooling_down"`
+}
+
+// ChannelRouteCandidate 候选渠道
+type ChannelRouteCandidate struct {
+	ChannelId       string            `json:"channel_id"`
+	Name            string            `json:"name"`
+	Type            int               `json:"type"`
+	Weight          int               `json:"weight"` // 配置的权重
+	HealthFactor    float64           `json:"health_factor"`
+	BudgetFactor    float64           `json:"budget_factor"`
+	EffectiveWeight float64           `json:"effective_weight"`
+	Probability     float64           `json:"probability"` // 使用该优先级时选中该渠道的概率
+	UpstreamModel   string            `json:"upstream_model"`
+	ModelMapped     bool              `json:"model_mapped"`
+	MappingError    string            `json:"mapping_error,omitempty"`
+	DisabledKeys    []ChannelRouteKey `json:"disabled_keys,omitempty"`
+}
+
+// ChannelRouteTier 同一优先级的候选渠道
+type ChannelRouteTier struct {
+	Priority   int64                   `json:"priority"`
+	Retry      int                     `json:"retry"`    // 第几次重试开始使用该优先级，最低优先级用于之后的所有重试
+	Selected   bool                    `json:"selected"` // 是否为本次 retry 使用的优先级
+	Candidates []ChannelRouteCandidate `json:"candidates"`
+}
+
+// ChannelRouteExclusion 被排除的渠道
+type ChannelRouteExclusion struct {
+	ChannelId string `json:"channel_id"`
+	Name      string `json:"name,omitempty"`
+	Priority  int64  `json:"priority"`
+	Reason    string `json:"reason"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// ChannelRouteExplain 分组+模型的渠道路由诊断结果
+type ChannelRouteExplain struct {
+	Group        string                  `json:"group"`
+	Model        string                  `json:"model"`
+	MatchedModel string                  `json:"matched_model"` // 能力表中匹配到的模型名，精确匹配不到时为规范化后的模型名
+	Retry        int                     `json:"retry"`
+	Tiers        []ChannelRouteTier      `json:"tiers"`
+	Excluded     []ChannelRouteExclusion `json:"excluded"`
+	Message      string                  `json:"message,omitempty"` // 没有可用渠道时实际选择返回的错误
+}
+
+// ExplainChannelRoute 诊断分组+模型在第 retry 次重试时的渠道选择
+func ExplainChannelRoute(group string, modelName string, retry int) (*ChannelRouteExplain, error) {
+	if !common.MemoryCacheEnabled {
+		return nil, errors.New("未启用内存缓存，无法诊断渠道路由")
+	}
+	explain := &ChannelRouteExplain{
+		Group:        group,
+		Model:        modelName,
+		MatchedModel: modelName,
+		Retry:        retry,
+		Tiers:        make([]ChannelRouteTier, 0),
+		Excluded:     make([]ChannelRouteExclusion, 0),
+	}
+
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+
+	channels := group2model2channels[group][modelName]
+	if len(channels) == 0 {
+		explain.MatchedModel = ratio_setting.FormatMatchingModelName(modelName)
+		channels = group2model2channels[group][explain.MatchedModel]
+	}
+	explain.Excluded = append(explain.Excluded, explainDisabledChannels(group, modelName, explain.MatchedModel)...)
+	if len(channels) == 0 {
+		explain.Message = fmt.Sprintf("分组 %s 下模型 %s 无可用渠道", group, modelName)
+		return explain, nil
+	}
+
+	// 与实际选择的顺序一致：熔断、冷却，再按优先级分层
+	available := make([]*Channel, 0, len(channels))
+	breakerOpen, coolingDown := 0, 0
+	for _, channelId := range channels {
+		channel, ok := channelsIDM[channelId]
+		if !ok {
+			explain.Excluded = append(explain.Excluded, ChannelRouteExclusion{ChannelId: channelId, Reason: ChannelExcludeNotFound})
+			continue
+		}
+		if !IsChannelBreakerAvailable(channelId, modelName) {
+			breakerOpen++
+			explain.Excluded = append(explain.Excluded, newChannelRouteExclusion(channel, ChannelExcludeBreakerOpen, ""))
+			continue
+		}
+		if isChannelCoolingDown(channelId) {
+			coolingDown++
+			explain.Excluded = append(explain.Excluded, newChannelRouteExclusion(channel, ChannelExcludeCoolingDown, ""))
+			continue
+		}
+		available = append(available, channel)
+	}
+	if len(available) == 0 {
+		if coolingDown == 0 && breakerOpen > 0 {
+			explain.Message = fmt.Sprintf("分组 %s 下模型 %s 的渠道均已熔断，请稍后再试", group, modelName)
+		} else if coolingDown > 0 {
+			explain.Message = fmt.Sprintf("分组 %s 下模型 %s 的渠道均已限流，请稍后再试", group, modelName)
+		} else {
+			explain.Message = fmt.Sprintf("数据库一致性错误，分组 %s 下模型 %s 的渠道不存在，请联系管理员修复", group, modelName)
+		}
+		return explain, nil
+	}
+
+	priorities := make([]int64, 0)
+	for _, channel := range available {
+		if !slices.Contains(priorities, channel.GetPriority()) {
+			priorities = append(priorities, channel.GetPriority())
+		}
+	}
+	sort.Slice(priorities, func(i, j int) bool {
+		return priorities[i] > priorities[j]
+	})
+	selectedTier := min(retry, len(priorities)-1)
+	for i, priority := range priorities {
+		tierChannels := make([]*Channel, 0)
+		for _, channel := range available {
+			if channel.GetPriority() == priority {
+				tierChannels = append(tierChannels, channel)
+			}
+		}
+		// 只有一个可用渠道时直接选中，不检查并发
+		if len(available) > 1 {
+			unsaturated := filterSaturatedChannels(tierChannels)
+			for _, channel := range tierChannels {
+				if !slices.Contains(unsaturated, channel) {
+					explain.Excluded = append(explain.Excluded, newChannelRouteExclusion(channel, ChannelExcludeSaturated, ""))
+				}
+			}
+			tierChannels = unsaturated
+		}
+		explain.Tiers = append(explain.Tiers, ChannelRouteTier{
+			Priority:   priority,
+			Retry:      i,
+			Selected:   i == selectedTier,
+			Candidates: explainChannelCandidates(tierChannels, modelName),
+		})
+	}
+	return explain, nil
+}
+
+func newChannelRouteExclusion(channel *Channel, reason string, detail string) ChannelRouteExclusion {
+	return ChannelRouteExclusion{
+		ChannelId: channel.Id,
+		Name:      channel.Name,
+		Priority:  channel.GetPriority(),
+		Reason:    reason,
+		Detail:    detail,
+	}
+}
+
+// explainDisabledChannels 分组中配置了该模型但已禁用的渠道，调用方需持有 channelSyncLock
+func explainDisabledChannels(group string, modelName string, matchedModel string) []ChannelRouteExclusion {
+	exclusions := make([]ChannelRouteExclusion, 0)
+	for _, channel := range channelsIDM {
+		if channel.Status == common.ChannelStatusEnabled {
+			continue
+		}
+		models := channel.GetModels()
+		if !slices.Contains(channel.GetGroups(), group) || !(slices.Contains(models, modelName) || slices.Contains(models, matchedModel)) {
+			continue
+		}
+		detail := "手动禁用"
+		if channel.Status == common.ChannelStatusAutoDisabled {
+			detail = "自动禁用"
+		}
+		if reason, ok := channel.GetOtherInfo()["status_reason"].(string); ok && reason != "" {
+			detail += ": " + reason
+		}
+		exclusions = append(exclusions, newChannelRouteExclusion(channel, ChannelExcludeDisabled, detail))
+	}
+	sort.Slice(exclusions, func(i, j int) bool {
+		return exclusions[i].ChannelId < exclusions[j].ChannelId
+	})
+	return exclusions
+}
+
+// explainChannelCandidates 计算同一优先级内各渠道的有效权重和选中概率
+func explainChannelCandidates(channels []*Channel, modelName string) []ChannelRouteCandidate {
+	weights := channelSelectionWeights(channels, modelName)
+	totalWeight := 0.0
+	for _, weight := range weights.Weights {
+		totalWeight += weight
+	}
+	candidates := make([]ChannelRouteCandidate, len(channels))
+	for i, channel := range channels {
+		candidates[i] = ChannelRouteCandidate{
+			ChannelId:       channel.Id,
+			Name:            channel.Name,
+			Type:            channel.Type,
+			Weight:          channel.GetWeight(),
+			HealthFactor:    weights.HealthFactors[i],
+			BudgetFactor:    weights.BudgetFactors[i],
+			EffectiveWeight: weights.Weights[i],
+			UpstreamModel:   modelName,
+			DisabledKeys:    explainDisabledKeys(channel),
+		}
+		if totalWeight > 0 {
+			candidates[i].Probability = weights.Weights[i] / totalWeight
+		}
+	}
+	return candidates
+}
+
+// explainDisabledKeys 多 key 渠道中已禁用或在冷却中的 key
+func explainDisabledKeys(channel *Channel) []ChannelRouteKey {
+	if !channel.ChannelInfo.IsMultiKey {
+		return nil
+	}
+	pollingLock := GetChannelPollingLock(channel.Id)
+	pollingLock.Lock()
+	defer pollingLock.Unlock()
+	keys := make([]ChannelRouteKey, 0)
+	for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+		status := common.ChannelStatusEnabled
+		if s, ok := channel.ChannelInfo.MultiKeyStatusList[i]; ok {
+			status = s
+		}
+		coolingDown := isChannelKeyCoolingDown(channel.Id, i)
+		if status == common.ChannelStatusEnabled && !coolingDown {
+			continue
+		}
+		keys = append(keys, ChannelRouteKey{
+			Index:       i,
+			Status:      status,
+			Reason:      strings.TrimSpace(channel.ChannelInfo.MultiKeyDisabledReason[i]),
+			CoolingDown: coolingDown,
+		})
+	}
+	return keys
+}
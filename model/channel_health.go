@@ -0,0 +1,305 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
+)
+
+// 渠道健康度：按渠道（多 key 渠道同时按 key 下标）统计成功率、首字延迟（TTFT）和总耗时的 EWMA，
+// 选择渠道时按健康度平滑降低同一优先级内渠道的有效权重，而不是等到自动禁用才停止分配流量。
+// 启用 Redis 时各节点的统计通过 Redis 共享：每次请求结果在 Redis 中原子更新，并定期同步到本地
+
+// channelHealthMinSamples 样本数不足时不按延迟降权，避免少量慢请求误伤
+const channelHealthMinSamples = 5
+
+const channelHealthRedisTTL = 24 * time.Hour
+
+// ChannelHealth 渠道或渠道 key 的健康度统计
+type ChannelHealth struct {
+	SuccessRate float64 `json:"success_rate"` // 成功率 EWMA，0-1
+	TTFTMs      float64 `json:"ttft_ms"`      // 首字延迟 EWMA（毫秒），非流式请求为总耗时
+	LatencyMs   float64 `json:"latency_ms"`   // 总耗时 EWMA（毫秒）
+	Samples     int64   `json:"samples"`
+	UpdatedAt   int64   `json:"updated_at"` // Unix 时间戳（秒）
+}
+
+var (
+	channelHealthStore     = make(map[string]*ChannelHealth)
+	channelHealthStoreLock sync.RWMutex
+	channelHealthSyncOnce  sync.Once
+)
+
+// channelHealthScript 在 Redis 中原子更新 EWMA，返回更新后的统计
+var channelHealthScript = redis.NewScript(`
+local alpha = tonumber(ARGV[1])
+local success = tonumber(ARGV[2])
+local ttft = tonumber(ARGV[3])
+local latency = tonumber(ARGV[4])
+local v = redis.call('HMGET', KEYS[1], 'success_rate', 'ttft_ms', 'latency_ms', 'samples')
+local rate = tonumber(v[1]) or 1
+local t = tonumber(v[2]) or 0
+local l = tonumber(v[3]) or 0
+local samples = (tonumber(v[4]) or 0) + 1
+rate = rate + alpha * (success - rate)
+if ttft > 0 then
+	if t <= 0 then t = ttft else t = t + alpha * (ttft - t) end
+end
+if latency > 0 then
+	if l <= 0 then l = latency else l = l + alpha * (latency - l) end
+end
+redis.call('HSET', KEYS[1], 'success_rate', tostring(rate), 'ttft_ms', tostring(t), 'latency_ms', tostring(l), 'samples', samples, 'updated_at', ARGV[5])
+redis.call('EXPIRE', KEYS[1], ARGV[6])
+return {tostring(rate), tostring(t), tostring(l), tostring(samples), ARGV[5]}
+`)
+
+func channelHealthKey(channelId string, keyIndex int) string {
+	if keyIndex < 0 {
+		return channelId
+	}
+	return fmt.Sprintf("%s:%d", channelId, keyIndex)
+}
+
+func channelHealthCacheKey(key string) string {
+	return "channel_health:" + key
+}
+
+// update 按 EWMA 合并一次请求结果，失败请求不更新延迟
+func (h *ChannelHealth) update(alpha float64, success bool, ttft, latency time.Duration, now time.Time) {
+	if h.Samples == 0 && h.UpdatedAt == 0 {
+		h.SuccessRate = 1
+	}
+	result := 0.0
+	if success {
+		result = 1
+	}
+	h.SuccessRate += alpha * (result - h.SuccessRate)
+	if ms := float64(ttft.Milliseconds()); ms > 0 {
+		if h.TTFTMs <= 0 {
+			h.TTFTMs = ms
+		} else {
+			h.TTFTMs += alpha * (ms - h.TTFTMs)
+		}
+	}
+	if ms := float64(latency.Milliseconds()); ms > 0 {
+		if h.LatencyMs <= 0 {
+			h.LatencyMs = ms
+		} else {
+			h.LatencyMs += alpha * (ms - h.LatencyMs)
+		}
+	}
+	h.Samples++
+	h.UpdatedAt = now.Unix()
+}
+
+// RecordChannelHealth 记录渠道一次请求的结果，keyIndex 为多 key 渠道使用的 key 下标，非多 key 渠道传 -1。
+// ttft、latency 为 0 表示不统计延迟（如失败请求、实时语音会话）
+func RecordChannelHealth(channelId string, keyIndex int, success bool, ttft, latency time.Duration) {
+	if !constant.ChannelHealthEnabled || channelId == "" {
+		return
+	}
+	if !success {
+		ttft, latency = 0, 0
+	}
+	keys := []string{channelHealthKey(channelId, -1)}
+	if keyIndex >= 0 {
+		keys = append(keys, channelHealthKey(channelId, keyIndex))
+	}
+	now := time.Now()
+	alpha := constant.ChannelHealthEwmaAlpha
+
+	channelHealthStoreLock.Lock()
+	for _, key := range keys {
+		h, ok := channelHealthStore[key]
+		if !ok {
+			h = &ChannelHealth{}
+			channelHealthStore[key] = h
+		}
+		h.update(alpha, success, ttft, latency, now)
+	}
+	channelHealthStoreLock.Unlock()
+
+	if !common.RedisEnabled {
+		return
+	}
+	gopool.Go(func() {
+		successArg := 0
+		if success {
+			successArg = 1
+		}
+		for _, key := range keys {
+			result, err := channelHealthScript.Run(context.Background(), common.RDB, []string{channelHealthCacheKey(key)},
+				alpha, successArg, ttft.Milliseconds(), latency.Milliseconds(), now.Unix(), int64(channelHealthRedisTTL.Seconds())).StringSlice()
+			if err != nil {
+				common.SysLog(fmt.Sprintf("failed to update channel health: key=%s, error=%v", key, err))
+				continue
+			}
+			if h, ok := parseChannelHealth(result); ok {
+				setChannelHealth(key, h)
+			}
+		}
+	})
+}
+
+func parseChannelHealth(values []string) (*ChannelHealth, bool) {
+	if len(values) < 5 {
+		return nil, false
+	}
+	h := &ChannelHealth{}
+	var err error
+	if h.SuccessRate, err = strconv.ParseFloat(values[0], 64); err != nil {
+		return nil, false
+	}
+	h.TTFTMs, _ = strconv.ParseFloat(values[1], 64)
+	h.LatencyMs, _ = strconv.ParseFloat(values[2], 64)
+	h.Samples, _ = strconv.ParseInt(values[3], 10, 64)
+	h.UpdatedAt, _ = strconv.ParseInt(values[4], 10, 64)
+	return h, true
+}
+
+func setChannelHealth(key string, h *ChannelHealth) {
+	channelHealthStoreLock.Lock()
+	channelHealthStore[key] = h
+	channelHealthStoreLock.Unlock()
+}
+
+// GetChannelHealth 获取渠道（keyIndex 为 -1）或渠道 key 的健康度，没有统计时返回 nil
+func GetChannelHealth(channelId string, keyIndex int) *ChannelHealth {
+	channelHealthStoreLock.RLock()
+	defer channelHealthStoreLock.RUnlock()
+	if h, ok := channelHealthStore[channelHealthKey(channelId, keyIndex)]; ok {
+		copied := *h
+		return &copied
+	}
+	return nil
+}
+
+// decay 距最后一次更新越久，统计越接近健康的初始值
+func (h *ChannelHealth) decay(now time.Time) float64 {
+	if constant.ChannelHealthHalfLifeSeconds <= 0 {
+		return 1
+	}
+	age := now.Unix() - h.UpdatedAt
+	if age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(constant.ChannelHealthHalfLifeSeconds))
+}
+
+// WeightFactor 健康度对应的权重系数：成功率的平方乘以相对延迟系数，
+// refTTFTMs 为同一优先级内的平均首字延迟，比平均值慢的渠道按 sqrt(平均/自身) 降权
+func (h *ChannelHealth) WeightFactor(refTTFTMs float64, now time.Time) float64 {
+	if h == nil {
+		return 1
+	}
+	decay := h.decay(now)
+	successRate := 1 - (1-h.SuccessRate)*decay
+	factor := successRate * successRate
+	if h.Samples >= channelHealthMinSamples && refTTFTMs > 0 && h.TTFTMs > refTTFTMs {
+		latencyFactor := math.Sqrt(refTTFTMs / h.TTFTMs)
+		factor *= 1 - (1-latencyFactor)*decay
+	}
+	return math.Max(constant.ChannelHealthMinWeightFactor, math.Min(1, factor))
+}
+
+// getChannelHealthFactors 计算同一优先级内各渠道（或同一渠道各 key）的权重系数
+func getChannelHealthFactors(keys []string) []float64 {
+	factors := make([]float64, len(keys))
+	if !constant.ChannelHealthEnabled {
+		for i := range factors {
+			factors[i] = 1
+		}
+		return factors
+	}
+	healths := make([]*ChannelHealth, len(keys))
+	channelHealthStoreLock.RLock()
+	for i, key := range keys {
+		healths[i] = channelHealthStore[key]
+	}
+	channelHealthStoreLock.RUnlock()
+
+	var sum float64
+	var count int
+	for _, h := range healths {
+		if h != nil && h.Samples >= channelHealthMinSamples && h.TTFTMs > 0 {
+			sum += h.TTFTMs
+			count++
+		}
+	}
+	refTTFTMs := 0.0
+	if count > 1 {
+		refTTFTMs = sum / float64(count)
+	}
+	now := time.Now()
+	for i, h := range healths {
+		factors[i] = h.WeightFactor(refTTFTMs, now)
+	}
+	return factors
+}
+
+// InitChannelHealthSync 启用 Redis 时定期从 Redis 拉取所有渠道的健康度，使本节点也能感知其他节点观测到的异常
+func InitChannelHealthSync() {
+	if !constant.ChannelHealthEnabled || !common.RedisEnabled {
+		return
+	}
+	channelHealthSyncOnce.Do(func() {
+		gopool.Go(func() {
+			for {
+				time.Sleep(time.Duration(constant.ChannelHealthSyncIntervalSeconds) * time.Second)
+				syncChannelHealthFromRedis()
+			}
+		})
+	})
+}
+
+func syncChannelHealthFromRedis() {
+	keys := make([]string, 0)
+	channelSyncLock.RLock()
+	for id, channel := range channelsIDM {
+		keys = append(keys, channelHealthKey(id, -1))
+		if channel.ChannelInfo.IsMultiKey {
+			for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+				keys = append(keys, channelHealthKey(id, i))
+			}
+		}
+	}
+	channelSyncLock.RUnlock()
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	pipe := common.RDB.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HMGet(ctx, channelHealthCacheKey(key), "success_rate", "ttft_ms", "latency_ms", "samples", "updated_at")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		common.SysLog("failed to sync channel health: " + err.Error())
+		return
+	}
+	for i, cmd := range cmds {
+		values, err := cmd.Result()
+		if err != nil || len(values) < 5 || values[0] == nil {
+			continue
+		}
+		strs := make([]string, len(values))
+		for j, v := range values {
+			if s, ok := v.(string); ok {
+				strs[j] = s
+			}
+		}
+		if h, ok := parseChannelHealth(strs); ok {
+			setChannelHealth(keys[i], h)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 多 key 渠道的 least_inflight / usage_balanced 模式：按 key 下标统计进行中的请求数和
+// 当前窗口内消费的额度，选择 key 时取最小值。启用 Redis 时计数保存在 Redis 中，各节点共享
+
+// 进行中计数的过期时间，节点异常退出未能释放计数时，渠道空闲后自动清零
+const channelKeyInflightTTL = 10 * time.Minute
+
+type channelKeyUsageWindow struct {
+	window int64
+	usage  map[int]int64
+}
+
+var (
+	channelKeyInflight    = make(map[string]map[int]int64) // channel id -> key index -> 进行中请求数
+	channelKeyUsage       = make(map[string]*channelKeyUsageWindow)
+	channelKeyBalanceLock sync.Mutex
+)
+
+func channelKeyInflightCacheKey(channelId string) string {
+	return "channel_key_inflight:" + channelId
+}
+
+func channelKeyUsageCacheKey(channelId string, window int64) string {
+	return fmt.Sprintf("channel_key_usage:%s:%d", channelId, window)
+}
+
+func channelKeyUsageWindowSeconds() int64 {
+	if constant.ChannelKeyUsageWindowSeconds <= 0 {
+		return 60
+	}
+	return int64(constant.ChannelKeyUsageWindowSeconds)
+}
+
+// currentChannelKeyUsageWindow 当前统计窗口的编号
+func currentChannelKeyUsageWindow() int64 {
+	return time.Now().Unix() / channelKeyUsageWindowSeconds()
+}
+
+// AcquireChannelKeyInflight 请求开始时增加 key 的进行中计数，需与 ReleaseChannelKeyInflight 成对调用
+func AcquireChannelKeyInflight(channelId string, keyIndex int) {
+	changeChannelKeyInflight(channelId, keyIndex, 1)
+}
+
+// ReleaseChannelKeyInflight 请求结束时减少 key 的进行中计数
+func ReleaseChannelKeyInflight(channelId string, keyIndex int) {
+	changeChannelKeyInflight(channelId, keyIndex, -1)
+}
+
+func changeChannelKeyInflight(channelId string, keyIndex int, delta int64) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := channelKeyInflightCacheKey(channelId)
+		pipe := common.RDB.TxPipeline()
+		pipe.HIncrBy(ctx, key, strconv.Itoa(keyIndex), delta)
+		pipe.Expire(ctx, key, channelKeyInflightTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysLog(fmt.Sprintf("failed to update channel key inflight: channel_id=%s, key_index=%d, error=%v", channelId, keyIndex, err))
+		}
+		return
+	}
+
+	channelKeyBalanceLock.Lock()
+	defer channelKeyBalanceLock.Unlock()
+	counts, ok := channelKeyInflight[channelId]
+	if !ok {
+		counts = make(map[int]int64)
+		channelKeyInflight[channelId] = counts
+	}
+	counts[keyIndex] += delta
+	if counts[keyIndex] <= 0 {
+		delete(counts, keyIndex)
+	}
+}
+
+// RecordChannelKeyUsage 记录 key 在当前窗口内消费的额度，只统计 usage_balanced 模式的渠道
+func RecordChannelKeyUsage(channelId string, mode constant.MultiKeyMode, keyIndex int, quota int) {
+	if mode != constant.MultiKeyModeUsageBalanced || quota <= 0 {
+		return
+	}
+	window := currentChannelKeyUsageWindow()
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			ctx := context.Background()
+			key := channelKeyUsageCacheKey(channelId, window)
+			pipe := common.RDB.TxPipeline()
+			pipe.HIncrBy(ctx, key, strconv.Itoa(keyIndex), int64(quota))
+			pipe.Expire(ctx, key, 2*time.Duration(channelKeyUsageWindowSeconds())*time.Second)
+			if _, err := pipe.Exec(ctx); err != nil {
+				common.SysLog(fmt.Sprintf("failed to record channel key usage: channel_id=%s, key_index=%d, error=%v", channelId, keyIndex, err))
+			}
+		})
+		return
+	}
+
+	channelKeyBalanceLock.Lock()
+	defer channelKeyBalanceLock.Unlock()
+	w, ok := channelKeyUsage[channelId]
+	if !ok || w.window != window {
+		w = &channelKeyUsageWindow{window: window, usage: make(map[int]int64)}
+		channelKeyUsage[channelId] = w
+	}
+	w.usage[keyIndex] += int64(quota)
+}
+
+// getChannelKeyCounts 读取渠道各 key 的计数，Redis 读取失败时返回空，此时各 key 视为相同
+func getChannelKeyCounts(mode constant.MultiKeyMode, channelId string) map[int]int64 {
+	counts := make(map[int]int64)
+	if common.RedisEnabled {
+		key := channelKeyInflightCacheKey(channelId)
+		if mode == constant.MultiKeyModeUsageBalanced {
+			key = channelKeyUsageCacheKey(channelId, currentChannelKeyUsageWindow())
+		}
+		values, err := common.RDB.HGetAll(context.Background(), key).Result()
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to get channel key counts: channel_id=%s, error=%v", channelId, err))
+			return counts
+		}
+		for field, value := range values {
+			idx, err1 := strconv.Atoi(field)
+			count, err2 := strconv.ParseInt(value, 10, 64)
+			if err1 == nil && err2 == nil {
+				counts[idx] = count
+			}
+		}
+		return counts
+	}
+
+	channelKeyBalanceLock.Lock()
+	defer channelKeyBalanceLock.Unlock()
+	source := channelKeyInflight[channelId]
+	if mode == constant.MultiKeyModeUsageBalanced {
+		source = nil
+		if w, ok := channelKeyUsage[channelId]; ok && w.window == currentChannelKeyUsageWindow() {
+			source = w.usage
+		}
+	}
+	for idx, count := range source {
+		counts[idx] = count
+	}
+	return counts
+}
+
+// pickKeyByLowestCount 选择计数最小的 key，计数相同时随机选择，避免并发请求集中到同一个 key
+func (channel *Channel) pickKeyByLowestCount(enabledIdx []int) int {
+	counts := getChannelKeyCounts(channel.ChannelInfo.MultiKeyMode, channel.Id)
+	candidates := make([]int, 0, len(enabledIdx))
+	var lowest int64
+	for _, idx := range enabledIdx {
+		count := max(counts[idx], 0)
+		switch {
+		case len(candidates) == 0 || count < lowest:
+			lowest = count
+			candidates = append(candidates[:0], idx)
+		case count == lowest:
+			candidates = append(candidates, idx)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
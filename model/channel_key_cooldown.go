@@ -0,0 +1,156 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+)
+
+// 多 key 渠道的 key 冷却：key 遇到 429、额度不足等暂时性错误时不再永久禁用，
+// 而是在冷却期内跳过，冷却期结束后自动恢复。冷却时间优先使用上游的 Retry-After，
+// 否则按连续冷却次数指数退避。冷却状态只在本节点内存中维护
+
+type channelKeyCooldown struct {
+	until    time.Time
+	failures int // 连续冷却次数，请求成功后清零
+}
+
+var (
+	channelKeyCooldowns = make(map[string]*channelKeyCooldown)
+	// 渠道所有可用 key 都在冷却时，记录最早恢复的时间，选择渠道时跳过
+	channelCooldownUntil    = make(map[string]time.Time)
+	channelKeyCooldownsLock sync.Mutex
+)
+
+// channelKeyCooldownDuration 计算冷却时间，Retry-After 不超过上限
+func channelKeyCooldownDuration(failures int, retryAfter time.Duration) time.Duration {
+	maxDuration := time.Duration(constant.ChannelKeyCooldownMaxSeconds) * time.Second
+	if retryAfter > 0 {
+		return min(retryAfter, maxDuration)
+	}
+	d := time.Duration(constant.ChannelKeyCooldownBaseSeconds) * time.Second
+	for i := 1; i < failures && d < maxDuration; i++ {
+		d *= 2
+	}
+	return min(d, maxDuration)
+}
+
+// CooldownChannelKey 使多 key 渠道的 key 进入冷却，返回冷却时间
+func CooldownChannelKey(channelId string, keyIndex int, retryAfter time.Duration) time.Duration {
+	channel, err := CacheGetChannel(channelId)
+	if err != nil || !channel.ChannelInfo.IsMultiKey {
+		return 0
+	}
+	// 与 GetNextEnabledKey 使用同一把锁读取 key 状态
+	pollingLock := GetChannelPollingLock(channelId)
+	pollingLock.Lock()
+	defer pollingLock.Unlock()
+
+	channelKeyCooldownsLock.Lock()
+	defer channelKeyCooldownsLock.Unlock()
+	key := channelHealthKey(channelId, keyIndex)
+	cooldown, ok := channelKeyCooldowns[key]
+	if !ok {
+		cooldown = &channelKeyCooldown{}
+		channelKeyCooldowns[key] = cooldown
+	}
+	now := time.Now()
+	cooldown.failures++
+	duration := channelKeyCooldownDuration(cooldown.failures, retryAfter)
+	cooldown.until = now.Add(duration)
+	common.SysLog(fmt.Sprintf("channel key cooldown: channel_id=%s, key_index=%d, failures=%d, duration=%s", channelId, keyIndex, cooldown.failures, duration))
+
+	// 检查该渠道是否所有启用的 key 都在冷却
+	var earliest time.Time
+	for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; ok && status != common.ChannelStatusEnabled {
+			continue
+		}
+		c, ok := channelKeyCooldowns[channelHealthKey(channelId, i)]
+		if !ok || !now.Before(c.until) {
+			return duration
+		}
+		if earliest.IsZero() || c.until.Before(earliest) {
+			earliest = c.until
+		}
+	}
+	if !earliest.IsZero() {
+		channelCooldownUntil[channelId] = earliest
+	}
+	return duration
+}
+
+// ClearChannelKeyCooldown key 请求成功后清除冷却记录
+func ClearChannelKeyCooldown(channelId string, keyIndex int) {
+	channelKeyCooldownsLock.Lock()
+	defer channelKeyCooldownsLock.Unlock()
+	delete(channelKeyCooldowns, channelHealthKey(channelId, keyIndex))
+	delete(channelCooldownUntil, channelId)
+}
+
+// filterCoolingDownKeys 过滤掉冷却中的 key；全部冷却时只保留最早恢复的 key，避免请求直接失败
+func filterCoolingDownKeys(channelId string, keyIndexes []int) []int {
+	channelKeyCooldownsLock.Lock()
+	defer channelKeyCooldownsLock.Unlock()
+	if len(channelKeyCooldowns) == 0 {
+		return keyIndexes
+	}
+	now := time.Now()
+	available := make([]int, 0, len(keyIndexes))
+	earliestIdx := -1
+	var earliest time.Time
+	for _, idx := range keyIndexes {
+		c, ok := channelKeyCooldowns[channelHealthKey(channelId, idx)]
+		if !ok || !now.Before(c.until) {
+			available = append(available, idx)
+			continue
+		}
+		if earliestIdx < 0 || c.until.Before(earliest) {
+			earliestIdx, earliest = idx, c.until
+		}
+	}
+	if len(available) == 0 && earliestIdx >= 0 {
+		available = append(available, earliestIdx)
+	}
+	return available
+}
+
+// isChannelKeyCoolingDown key 是否在冷却中
+func isChannelKeyCoolingDown(channelId string, keyIndex int) bool {
+	channelKeyCooldownsLock.Lock()
+	defer channelKeyCooldownsLock.Unlock()
+	c, ok := channelKeyCooldowns[channelHealthKey(channelId, keyIndex)]
+	return ok && time.Now().Before(c.until)
+}
+
+// isChannelCoolingDown 多 key 渠道所有可用 key 是否都在冷却
+func isChannelCoolingDown(channelId string) bool {
+	channelKeyCooldownsLock.Lock()
+	defer channelKeyCooldownsLock.Unlock()
+	until, ok := channelCooldownUntil[channelId]
+	return ok && time.Now().Before(until)
+}
+
+// filterCoolingDownChannels 过滤掉所有可用 key 都在冷却的多 key 渠道，不修改原切片
+func filterCoolingDownChannels(channelIds []string) []string {
+	channelKeyCooldownsLock.Lock()
+	defer channelKeyCooldownsLock.Unlock()
+	if len(channelCooldownUntil) == 0 {
+		return channelIds
+	}
+	now := time.Now()
+	available := make([]string, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		if until, ok := channelCooldownUntil[channelId]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(channelCooldownUntil, channelId)
+		}
+		available = append(available, channelId)
+	}
+	return available
+}
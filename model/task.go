@@ -99,7 +99,8 @@ func (m Properties) Value() (driver.Value, error) {
 }
 
 type TaskPrivateData struct {
-	Key string `json:"key,omitempty"`
+	Key     string `json:"key,omitempty"`
+	TokenId string `json:"token_id,omitempty"` // 提交任务的令牌，用于异步补扣/退还时更新令牌消费
 }
 
 func (p *TaskPrivateData) Scan(val interface{}) error {
@@ -133,6 +134,9 @@ type SyncTaskQueryParams struct {
 func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo) *Task {
 	properties := Properties{}
 	privateData := TaskPrivateData{}
+	if relayInfo != nil {
+		privateData.TokenId = relayInfo.TokenId
+	}
 	if relayInfo != nil && relayInfo.ChannelMeta != nil {
 		if relayInfo.ChannelMeta.ChannelType == constant.ChannelTypeGemini {
 			privateData.Key = relayInfo.ChannelMeta.ApiKey
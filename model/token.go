@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"relay-gateway/common"
+	"relay-gateway/constant"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -163,7 +164,14 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 		// Don't return error - fall through to DB
 	}
 	fromDB = true
-	err = DB.Table("t_api_keys").Where(commonKeyCol+" = ?", key).Where("deleted = ?", 0).First(&token).Error
+	err = DB.Table("t_api_keys").Where("key_hash = ?", common.GenerateHMAC(key)).Where("deleted = ?", 0).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && constant.TokenLegacyKeyLookup {
+		err = DB.Table("t_api_keys").Where(commonKeyCol+" = ?", key).Where("deleted = ?", 0).First(&token).Error
+	}
+	if err == nil {
+		// 数据库中不再保存明文 key，恢复为请求中的 key 以便计算缓存键
+		token.Key = key
+	}
 	return token, err
 }
 
@@ -267,7 +275,8 @@ func IncreaseTokenQuota(id string, key string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if common.RedisEnabled {
+	// 子令牌请求没有父令牌明文 key，只更新数据库
+	if common.RedisEnabled && key != "" {
 		gopool.Go(func() {
 			err := cacheIncrTokenQuota(key, int64(quota))
 			if err != nil {
@@ -275,6 +284,7 @@ func IncreaseTokenQuota(id string, key string, quota int) (err error) {
 			}
 		})
 	}
+	localCacheAdjustTokenEnhancedIdQuota(id, quota)
 	if common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
 		return nil
@@ -297,7 +307,7 @@ func DecreaseTokenQuota(id string, key string, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if common.RedisEnabled {
+	if common.RedisEnabled && key != "" {
 		gopool.Go(func() {
 			err := cacheDecrTokenQuota(key, int64(quota))
 			if err != nil {
@@ -305,6 +315,7 @@ func DecreaseTokenQuota(id string, key string, quota int) (err error) {
 			}
 		})
 	}
+	localCacheAdjustTokenEnhancedIdQuota(id, -quota)
 	if common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeTokenQuota, id, -quota)
 		return nil
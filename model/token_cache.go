@@ -9,6 +9,10 @@ import (
 )
 
 func cacheSetToken(token Token) error {
+	if token.Key == "" {
+		// 明文 key 已清除（按 id 查询得到的令牌），无法计算缓存键
+		return nil
+	}
 	key := common.GenerateHMAC(token.Key)
 	token.Clean()
 	err := common.RedisHSetObj(fmt.Sprintf("token:%s", key), &token, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
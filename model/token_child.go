@@ -0,0 +1,222 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 子令牌：父令牌签发的短期 JWT，供浏览器、移动端等前端直接使用，避免暴露长期 sk- key。
+// 子令牌不落库，验证时只校验签名并读取父令牌，费用、额度、IP 和接口范围限制均沿用父令牌；
+// 父令牌轮换 key 后，旧 key 宽限期结束时其签发的子令牌随之失效
+
+const childTokenIssuer = "relay-gateway"
+
+// ChildTokenClaims 子令牌内容，sub 为父令牌 id，jti 用于子令牌单独的限流和消费计数
+type ChildTokenClaims struct {
+	// 签发时父令牌 key 哈希的前 8 位，用于在父令牌轮换后使子令牌失效
+	KeyTag     string   `json:"ktag"`
+	Models     []string `json:"models,omitempty"`      // 允许使用的模型，为空表示沿用父令牌
+	SpendLimit int      `json:"spend_limit,omitempty"` // 消费上限（额度，即美分），0 表示不限制
+	RateLimit  int      `json:"rpm,omitempty"`         // 每分钟请求数，0 表示不限制
+	jwt.RegisteredClaims
+}
+
+var (
+	childTokenSpendingMemory     = common.NewLocalCache(time.Hour)
+	childTokenSpendingMemoryLock sync.Mutex
+)
+
+func childTokenSigningKey() []byte {
+	if constant.ChildTokenSecret != "" {
+		return []byte(constant.ChildTokenSecret)
+	}
+	return []byte(common.CryptoSecret)
+}
+
+func childTokenKeyTag(keyHash string) string {
+	if len(keyHash) < 8 {
+		return keyHash
+	}
+	return keyHash[:8]
+}
+
+// IsChildToken 判断请求中的 key 是否为子令牌（JWT 格式）
+func IsChildToken(key string) bool {
+	return strings.HasPrefix(key, "eyJ") && strings.Count(key, ".") == 2
+}
+
+// SignChildToken 使用父令牌签发子令牌，返回 JWT 和过期时间
+func SignChildToken(parent *TokenEnhanced, ttl time.Duration, models []string, spendLimit int, rateLimit int) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := ChildTokenClaims{
+		KeyTag:     childTokenKeyTag(parent.KeyHash),
+		Models:     models,
+		SpendLimit: spendLimit,
+		RateLimit:  rateLimit,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    childTokenIssuer,
+			Subject:   parent.Id,
+			ID:        common.GetUUID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(childTokenSigningKey())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseChildToken 校验子令牌签名和有效期
+func ParseChildToken(key string) (*ChildTokenClaims, error) {
+	claims := &ChildTokenClaims{}
+	_, err := jwt.ParseWithClaims(key, claims, func(t *jwt.Token) (interface{}, error) {
+		return childTokenSigningKey(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(childTokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, errors.New("子令牌已过期")
+		}
+		return nil, errors.New("无效的子令牌")
+	}
+	if claims.Subject == "" || claims.ID == "" {
+		return nil, errors.New("无效的子令牌")
+	}
+	return claims, nil
+}
+
+func getTokenEnhancedIdCacheKey(id string) string {
+	return fmt.Sprintf("token_enhanced_id:%s", id)
+}
+
+// invalidateTokenEnhancedIdCache 清除按 id 缓存的令牌并通知其他节点，
+// 令牌 key 哈希、状态或额度变化时调用，避免子令牌按过期的父令牌验证
+func invalidateTokenEnhancedIdCache(id string) {
+	tokenLocalCache.Delete(getTokenEnhancedIdCacheKey(id))
+	PublishCacheInvalidation(CacheInvalidationTokenId, id)
+}
+
+// localCacheAdjustTokenEnhancedIdQuota 同步调整本节点按 id 缓存的令牌额度，
+// 额度用尽时通知其他节点重新加载，使其签发的子令牌随之失效
+func localCacheAdjustTokenEnhancedIdQuota(id string, delta int) {
+	localCacheKey := getTokenEnhancedIdCacheKey(id)
+	cachedValue, found := tokenLocalCache.Get(localCacheKey)
+	if !found {
+		return
+	}
+	cachedToken, ok := cachedValue.(*TokenEnhanced)
+	if !ok {
+		return
+	}
+	tokenCopy := *cachedToken
+	tokenCopy.RemainQuota += delta
+	tokenCopy.UsedQuota -= delta
+	tokenLocalCache.SetWithTTL(localCacheKey, &tokenCopy, tokenCopy.cacheTTL("", tokenLocalCacheTTL))
+	if cachedToken.HasQuotaRemaining() && !tokenCopy.HasQuotaRemaining() {
+		PublishCacheInvalidation(CacheInvalidationTokenId, id)
+	}
+}
+
+// GetTokenEnhancedByIdCached 按 id 查询令牌，使用本地缓存，令牌 key、状态或额度变化时清除
+func GetTokenEnhancedByIdCached(id string) (*TokenEnhanced, error) {
+	localCacheKey := getTokenEnhancedIdCacheKey(id)
+	if cachedValue, found := tokenLocalCache.Get(localCacheKey); found {
+		if cachedToken, ok := cachedValue.(*TokenEnhanced); ok {
+			tokenCopy := *cachedToken
+			return &tokenCopy, nil
+		}
+	}
+	token, err := GetTokenEnhancedById(id)
+	if err != nil {
+		return nil, err
+	}
+	token.Key = "" // 不缓存明文key
+	token.ipAccessList = token.parseIpAccessList()
+	tokenCopy := *token
+	tokenLocalCache.SetWithTTL(localCacheKey, &tokenCopy, token.cacheTTL("", tokenLocalCacheTTL))
+	return token, nil
+}
+
+// ValidateChildToken 验证子令牌，返回父令牌；父令牌不可用或已轮换时子令牌同样不可用
+func ValidateChildToken(key string) (*TokenEnhanced, *ChildTokenClaims, error) {
+	claims, err := ParseChildToken(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := GetTokenEnhancedByIdCached(claims.Subject)
+	if err != nil {
+		return nil, nil, errors.New("子令牌的父令牌不存在")
+	}
+	switch {
+	case claims.KeyTag == childTokenKeyTag(token.KeyHash):
+	case token.PreviousKeyHash != nil && claims.KeyTag == childTokenKeyTag(*token.PreviousKeyHash) &&
+		token.PreviousKeyExpiresAt != nil && token.PreviousKeyExpiresAt.After(time.Now()):
+	default:
+		return token, nil, errors.New("父令牌已轮换，子令牌已失效")
+	}
+	if token.Status == common.TokenStatusExhausted || !token.HasQuotaRemaining() {
+		return token, nil, errors.New("父令牌额度已用尽")
+	}
+	if token.IsExpired() {
+		return token, nil, errors.New("父令牌已过期")
+	}
+	if token.Status != common.TokenStatusEnabled {
+		return token, nil, errors.New("父令牌状态不可用")
+	}
+	return token, claims, nil
+}
+
+func getChildTokenSpendingCacheKey(childTokenId string) string {
+	return fmt.Sprintf("child_token_spending:%s", childTokenId)
+}
+
+// IncreaseChildTokenSpending 累加子令牌消费额度，计数保留到子令牌最长有效期之后
+func IncreaseChildTokenSpending(childTokenId string, quota int) {
+	if childTokenId == "" || quota == 0 {
+		return
+	}
+	ttl := time.Duration(constant.ChildTokenMaxTTLSeconds)*time.Second + time.Hour
+	if common.RedisEnabled {
+		if _, err := common.RedisIncrByExpireAt(getChildTokenSpendingCacheKey(childTokenId), int64(quota), time.Now().Add(ttl)); err != nil {
+			common.SysLog(fmt.Sprintf("failed to increase child token spending: child_token_id=%s, quota=%d, error=%v", childTokenId, quota, err))
+		}
+		return
+	}
+
+	childTokenSpendingMemoryLock.Lock()
+	defer childTokenSpendingMemoryLock.Unlock()
+	spent := 0
+	if value, found := childTokenSpendingMemory.Get(childTokenId); found {
+		spent = value.(int)
+	}
+	childTokenSpendingMemory.SetWithTTL(childTokenId, spent+quota, ttl)
+}
+
+// GetChildTokenSpending 获取子令牌已消费额度
+func GetChildTokenSpending(childTokenId string) (int, error) {
+	if common.RedisEnabled {
+		spent, err := common.RedisGetInt64(getChildTokenSpendingCacheKey(childTokenId))
+		return int(spent), err
+	}
+
+	childTokenSpendingMemoryLock.Lock()
+	defer childTokenSpendingMemoryLock.Unlock()
+	if value, found := childTokenSpendingMemory.Get(childTokenId); found {
+		return value.(int), nil
+	}
+	return 0, nil
+}
@@ -9,8 +9,11 @@ import (
 	"relay-gateway/common"
 )
 
+// 本地缓存过期时间
+const tokenLocalCacheTTL = 60 * 60 * time.Second
+
 // 本地缓存实例（1h过期）
-var tokenLocalCache = common.NewLocalCache(60 * 60 * time.Second)
+var tokenLocalCache = common.NewLocalCache(tokenLocalCacheTTL)
 
 // TokenEnhanced 融合后的增强版 Token 结构体
 // 融合了现有 Token 和新 t_api_keys 表的设计
@@ -20,14 +23,18 @@ type TokenEnhanced struct {
 	UserId string `json:"user_id" gorm:"type:varchar(32);index;not null"` // 改为 varchar(32)
 
 	// ========== Key 相关字段（安全性增强）==========
-	// 保留明文 key 用于向后兼容，但建议逐步迁移到 key_hash
-	Key string `json:"key" gorm:"type:char(48);uniqueIndex"` // 保留用于兼容
+	// 明文 key 仅存在于未迁移的旧数据中，新数据与迁移后的数据均为 NULL，查询统一使用 key_hash
+	Key string `json:"key" gorm:"type:char(48);uniqueIndex;default:null"` // 保留用于兼容
 
 	// 新增：安全存储方式
-	KeyHash    string `json:"key_hash" gorm:"type:varchar(255);uniqueIndex;not null"` // SHA256 哈希值
+	KeyHash    string `json:"key_hash" gorm:"type:varchar(255);uniqueIndex;not null"` // HMAC-SHA256 哈希值（common.GenerateHMAC）
 	KeyPrefix  string `json:"key_prefix" gorm:"type:varchar(100);not null"`           // 前缀，如：ak_123456
 	DisplayKey string `json:"display_key" gorm:"type:varchar(32)"`                    // 展示用，如：sk_ah_v1-prefix01
 
+	// 轮换：旧 key 的哈希在宽限期截止前仍然有效
+	PreviousKeyHash      *string    `json:"-" gorm:"type:varchar(255);index"`
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at" gorm:"type:timestamptz(6)"`
+
 	// ========== 基本信息 ==========
 	Name        string  `json:"name" gorm:"type:varchar(100);index;not null"`
 	Description *string `json:"description" gorm:"type:text"` // 新增描述字段
@@ -42,6 +49,8 @@ type TokenEnhanced struct {
 	UpdatedAt  *time.Time `json:"updated_at" gorm:"type:timestamptz(6);default:now()"` // 更新时间
 	LastUsedAt *time.Time `json:"last_used_at" gorm:"type:timestamptz(6)"`             // 最后使用时间
 	ExpiresAt  *time.Time `json:"expires_at" gorm:"type:timestamptz(6)"`               // 过期时间（nil 表示永不过期）
+	// 已发送即将过期通知的时间，修改过期时间后清空以便重新通知
+	ExpiryNotifiedAt *time.Time `json:"-" gorm:"type:timestamptz(6)"`
 
 	// ========== 配额管理（现有功能保留）==========
 	RemainQuota    int  `json:"remain_quota" gorm:"default:0"`
@@ -65,7 +74,13 @@ type TokenEnhanced struct {
 	// ========== 访问控制（现有功能保留）==========
 	ModelLimitsEnabled bool    `json:"model_limits_enabled"`
 	ModelLimits        string  `json:"model_limits" gorm:"type:varchar(1024);default:''"`
-	AllowIps           *string `json:"allow_ips" gorm:"default:''"`
+	AllowIps           *string `json:"allow_ips" gorm:"default:''"` // IP 或 CIDR，换行或逗号分隔，! 开头为拒绝规则
+
+	// 接口范围，逗号分隔，如 embeddings,images；为空或 * 表示不限制
+	Scopes string `json:"scopes" gorm:"type:varchar(255);default:''"`
+
+	// AllowIps 解析结果，写入本地缓存前解析，避免每次请求重复解析
+	ipAccessList *common.IpAccessList
 
 	// ========== 分组管理（现有功能保留）==========
 	Group string `json:"group" gorm:"type:varchar(100);default:''"`
@@ -165,12 +180,26 @@ func (token *TokenEnhanced) HasQuotaRemaining() bool {
 	return token.RemainQuota > 0
 }
 
-// CheckRateLimit 检查速率限制（需要配合 Redis 或其他缓存实现）
-// 这里只是结构定义，实际实现需要根据业务逻辑
-func (token *TokenEnhanced) CheckRateLimit() bool {
-	// TODO: 实现速率限制检查逻辑
-	// 需要配合 Redis 记录每分钟/小时/天的请求数
-	return true
+// RateLimitWindow 速率限制窗口
+type RateLimitWindow struct {
+	Name     string // 窗口名称：minute/hour/day，用于限流 key 和响应头后缀
+	Limit    int    // 窗口内允许的请求数
+	Duration int64  // 窗口长度（秒）
+}
+
+// GetRateLimitWindows 返回已配置的速率限制窗口（<=0 表示该窗口不限制）
+func (token *TokenEnhanced) GetRateLimitWindows() []RateLimitWindow {
+	windows := make([]RateLimitWindow, 0, 3)
+	if token.RateLimitPerMinute > 0 {
+		windows = append(windows, RateLimitWindow{Name: "minute", Limit: token.RateLimitPerMinute, Duration: 60})
+	}
+	if token.RateLimitPerHour > 0 {
+		windows = append(windows, RateLimitWindow{Name: "hour", Limit: token.RateLimitPerHour, Duration: 60 * 60})
+	}
+	if token.RateLimitPerDay > 0 {
+		windows = append(windows, RateLimitWindow{Name: "day", Limit: token.RateLimitPerDay, Duration: 24 * 60 * 60})
+	}
+	return windows
 }
 
 // CheckSpendingLimit 检查消费限制
@@ -193,6 +222,7 @@ func (token *TokenEnhanced) SelectUpdate() (err error) {
 	if err != nil {
 		return err
 	}
+	invalidateTokenEnhancedIdCache(token.Id)
 
 	// 同步更新本地缓存
 	if token.Key != "" {
@@ -255,10 +285,11 @@ func GetTokenEnhancedByKey(key string, fromDB bool) (token *TokenEnhanced, err e
 		if err == nil {
 			// 从Redis缓存成功读取，恢复原始key
 			token.Key = key
+			token.ipAccessList = token.parseIpAccessList()
 			// 写入本地缓存
 			tokenCopy := *token
 			tokenCopy.Key = "" // 不缓存明文key
-			tokenLocalCache.Set(cacheKey, &tokenCopy)
+			tokenLocalCache.SetWithTTL(cacheKey, &tokenCopy, token.cacheTTL(hmacKey, tokenLocalCacheTTL))
 			common.SysLog(fmt.Sprintf("[TokenCache] Redis Cache HIT for key=%s, status=%d, remain_quota=%d", keyPrefix, token.Status, token.RemainQuota))
 			return token, nil
 		}
@@ -266,27 +297,27 @@ func GetTokenEnhancedByKey(key string, fromDB bool) (token *TokenEnhanced, err e
 		common.SysLog(fmt.Sprintf("[TokenCache] Redis Cache MISS for key=%s, error=%v", keyPrefix, err))
 	}
 
-	// 3. 从数据库读取
-	token = &TokenEnhanced{}
-	err = DB.Where("key = ? AND deleted = ?", key, 0).First(token).Error
+	// 3. 从数据库读取（按 key_hash 查询）
+	token, err = getTokenEnhancedFromDB(key)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("[TokenCache] DB query FAILED for key=%s, error=%v", keyPrefix, err))
 		return nil, err
 	}
 
 	common.SysLog(fmt.Sprintf("[TokenCache] DB query SUCCESS for key=%s, status=%d, remain_quota=%d", keyPrefix, token.Status, token.RemainQuota))
+	token.ipAccessList = token.parseIpAccessList()
 
 	// 4. 写入本地缓存
 	hmacKey := common.GenerateHMAC(key)
 	localCacheKey := fmt.Sprintf("token_enhanced:%s", hmacKey)
 	tokenCopy := *token
 	tokenCopy.Key = "" // 不缓存明文key
-	tokenLocalCache.Set(localCacheKey, &tokenCopy)
+	tokenLocalCache.SetWithTTL(localCacheKey, &tokenCopy, token.cacheTTL(hmacKey, tokenLocalCacheTTL))
 
 	// 5. 写入Redis缓存
 	if common.RedisEnabled {
 		cacheKey := fmt.Sprintf("token_enhanced:%s", hmacKey)
-		cacheErr := common.RedisSetJSON(cacheKey, &tokenCopy, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+		cacheErr := common.RedisSetJSON(cacheKey, &tokenCopy, token.cacheTTL(hmacKey, time.Duration(common.RedisKeyCacheSeconds())*time.Second))
 		if cacheErr != nil {
 			common.SysLog(fmt.Sprintf("[TokenCache] Redis Cache WRITE FAILED for key=%s, error=%v", keyPrefix, cacheErr))
 		} else {
@@ -325,6 +356,10 @@ func ValidateUserTokenEnhanced(key string) (token *TokenEnhanced, err error) {
 			}
 			return token, errors.New("该令牌已过期")
 		}
+		// 轮换后的旧 key 超过宽限期即失效
+		if remaining, isPrevious := token.GetPreviousKeyRemaining(key); isPrevious && remaining <= 0 {
+			return token, errors.New("该令牌已轮换，旧 key 已失效，请使用新的 key")
+		}
 		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
 			if !common.RedisEnabled {
 				// in this case, we can make sure the token is exhausted
@@ -343,27 +378,50 @@ func ValidateUserTokenEnhanced(key string) (token *TokenEnhanced, err error) {
 	return nil, errors.New("无效的令牌")
 }
 
-// GetIpLimitsMapEnhanced 获取 IP 限制映射（TokenEnhanced 版本）
-func (token *TokenEnhanced) GetIpLimitsMapEnhanced() map[string]any {
-	// delete empty spaces
-	//split with \n
-	ipLimitsMap := make(map[string]any)
+// GetIpAccessList 获取 IP 访问控制列表（TokenEnhanced 版本），缓存中的令牌直接使用已解析的结果
+func (token *TokenEnhanced) GetIpAccessList() *common.IpAccessList {
+	if token.ipAccessList != nil {
+		return token.ipAccessList
+	}
+	return token.parseIpAccessList()
+}
+
+func (token *TokenEnhanced) parseIpAccessList() *common.IpAccessList {
 	if token.AllowIps == nil {
-		return ipLimitsMap
-	}
-	cleanIps := strings.ReplaceAll(*token.AllowIps, " ", "")
-	if cleanIps == "" {
-		return ipLimitsMap
-	}
-	ips := strings.Split(cleanIps, "\n")
-	for _, ip := range ips {
-		ip = strings.TrimSpace(ip)
-		ip = strings.ReplaceAll(ip, ",", "")
-		if common.IsIP(ip) {
-			ipLimitsMap[ip] = true
+		return &common.IpAccessList{}
+	}
+	// 存在无效条目时拒绝所有 IP，避免规则写错后令牌对所有 IP 开放
+	list, err := common.ParseIpAccessList(*token.AllowIps)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid allow_ips for token_id=%s, denying all IPs: %v", token.Id, err))
+		return common.DenyAllIpAccessList()
+	}
+	return list
+}
+
+// GetScopes 获取接口范围列表，为空表示不限制
+func (token *TokenEnhanced) GetScopes() []string {
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(token.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
 		}
 	}
-	return ipLimitsMap
+	return scopes
+}
+
+// AllowsScope 检查令牌是否有权访问该接口范围，上级范围（如 audio）包含其下所有范围（如 audio.speech）
+func (token *TokenEnhanced) AllowsScope(scope string) bool {
+	scopes := token.GetScopes()
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == "*" || s == scope || (scope != "" && strings.HasPrefix(scope, s+".")) {
+			return true
+		}
+	}
+	return false
 }
 
 // GetModelLimits 获取模型限制列表（TokenEnhanced 版本）
@@ -410,7 +468,7 @@ func CacheSetTokenEnhanced(token *TokenEnhanced) error {
 	hmacKey := common.GenerateHMAC(originalKey)
 	cacheKey := fmt.Sprintf("token_enhanced:%s", hmacKey)
 
-	return common.RedisSetJSON(cacheKey, &tokenCopy, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+	return common.RedisSetJSON(cacheKey, &tokenCopy, token.cacheTTL(hmacKey, time.Duration(common.RedisKeyCacheSeconds())*time.Second))
 }
 
 // CacheDeleteTokenEnhanced 从 Redis 缓存删除 TokenEnhanced
@@ -424,7 +482,10 @@ func CacheDeleteTokenEnhanced(key string) error {
 	}
 	hmacKey := common.GenerateHMAC(key)
 	cacheKey := fmt.Sprintf("token_enhanced:%s", hmacKey)
-	return common.RedisDelKey(cacheKey)
+	err := common.RedisDelKey(cacheKey)
+	// Redis 删除完成后再通知其他节点，避免其他节点重新加载到尚未删除的旧值
+	PublishCacheInvalidation(CacheInvalidationToken, hmacKey)
+	return err
 }
 
 // CacheUpdateTokenEnhancedQuota 更新 Redis 缓存中的 Token 配额
@@ -459,8 +520,9 @@ func LocalCacheSetTokenEnhanced(key string, token *TokenEnhanced) {
 	// 缓存token副本（不包含敏感key）
 	tokenCopy := *token
 	tokenCopy.Key = "" // 不缓存明文key
+	tokenCopy.ipAccessList = tokenCopy.parseIpAccessList()
 
-	tokenLocalCache.Set(localCacheKey, &tokenCopy)
+	tokenLocalCache.SetWithTTL(localCacheKey, &tokenCopy, token.cacheTTL(hmacKey, tokenLocalCacheTTL))
 
 	keyPrefix := key
 	if len(key) > 10 {
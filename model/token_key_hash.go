@@ -0,0 +1,133 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+
+	"gorm.io/gorm"
+)
+
+// 令牌 key 仅以 HMAC 哈希形式存储和检索，明文 key 只在创建时返回给用户一次
+
+// errCryptoSecretNotConfigured 未设置密钥时 key 哈希重启后无法匹配，拒绝写入只有哈希的 key
+var errCryptoSecretNotConfigured = errors.New("未设置 CRYPTO_SECRET 或 SESSION_SECRET，重启后 key 哈希将无法匹配，请先设置后再生成令牌 key")
+
+// CheckTokenKeyHashSecret 检查 key 哈希使用的密钥是否在重启后保持不变
+func CheckTokenKeyHashSecret() error {
+	if !common.CryptoSecretConfigured {
+		return errCryptoSecretNotConfigured
+	}
+	return nil
+}
+
+// FillKeyFields 根据明文 key 填充 KeyHash、KeyPrefix、DisplayKey，不会保留明文 key
+func (token *TokenEnhanced) FillKeyFields(key string) {
+	token.KeyHash = common.GenerateHMAC(key)
+	token.KeyPrefix = getTokenKeyPrefix(key)
+	token.DisplayKey = getTokenDisplayKey(key)
+}
+
+// getTokenKeyPrefix 前缀，如：sk-abcd1234
+func getTokenKeyPrefix(key string) string {
+	if len(key) > 8 {
+		return "sk-" + key[:8]
+	}
+	return "sk-" + key
+}
+
+// getTokenDisplayKey 展示用，如：sk-abcd...wxyz
+func getTokenDisplayKey(key string) string {
+	if len(key) <= 8 {
+		return "sk-***"
+	}
+	return "sk-" + key[:4] + "..." + key[len(key)-4:]
+}
+
+func tokenKeyFieldsUpdates(token *TokenEnhanced) map[string]interface{} {
+	return map[string]interface{}{
+		"key_hash":    token.KeyHash,
+		"key_prefix":  token.KeyPrefix,
+		"display_key": token.DisplayKey,
+	}
+}
+
+// getTokenEnhancedFromDB 按 key_hash 查询令牌；兼容模式下查不到时回退到明文 key，并回填哈希字段
+func getTokenEnhancedFromDB(key string) (*TokenEnhanced, error) {
+	token := &TokenEnhanced{}
+	hmacKey := common.GenerateHMAC(key)
+	// 轮换宽限期内的旧 key 通过 previous_key_hash 匹配
+	err := DB.Where("(key_hash = ? OR previous_key_hash = ?) AND deleted = ?", hmacKey, hmacKey, 0).First(token).Error
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) || !constant.TokenLegacyKeyLookup {
+		return nil, err
+	}
+
+	token = &TokenEnhanced{}
+	err = DB.Where(commonKeyCol+" = ? AND deleted = ?", key, 0).First(token).Error
+	if err != nil {
+		return nil, err
+	}
+	token.FillKeyFields(key)
+	if err := DB.Model(&TokenEnhanced{}).Where("id = ?", token.Id).Updates(tokenKeyFieldsUpdates(token)).Error; err != nil {
+		common.SysLog(fmt.Sprintf("[TokenCache] backfill key hash FAILED for token_id=%s, error=%v", token.Id, err))
+	} else {
+		common.SysLog(fmt.Sprintf("[TokenCache] backfill key hash SUCCESS for token_id=%s", token.Id))
+	}
+	return token, nil
+}
+
+// MigrateTokenKeysToHashOnly 为所有仍保存明文 key 的令牌回填 key_hash、key_prefix、display_key，
+// 全部回填成功后将明文 key 列置为 NULL；只要有一行回填失败就不会清空
+func MigrateTokenKeysToHashOnly() (backfilled int, cleared int64, err error) {
+	if err = CheckTokenKeyHashSecret(); err != nil {
+		return 0, 0, err
+	}
+	failed := 0
+	// 已确认哈希与明文 key 一致的令牌，只清空这些令牌的明文 key
+	verified := make(map[string]string)
+	var tokens []*TokenEnhanced
+	err = DB.Model(&TokenEnhanced{}).
+		Select("id", "key", "key_hash", "key_prefix", "display_key").
+		Where(commonKeyCol+" IS NOT NULL AND "+commonKeyCol+" <> ''").
+		FindInBatches(&tokens, 200, func(tx *gorm.DB, batch int) error {
+			for _, token := range tokens {
+				key := token.Key
+				if token.KeyHash == common.GenerateHMAC(key) && token.KeyPrefix != "" && token.DisplayKey != "" {
+					verified[token.Id] = key
+					continue
+				}
+				token.FillKeyFields(key)
+				if err := DB.Model(&TokenEnhanced{}).Where("id = ?", token.Id).Updates(tokenKeyFieldsUpdates(token)).Error; err != nil {
+					common.SysLog(fmt.Sprintf("failed to backfill key hash: token_id=%s, error=%v", token.Id, err))
+					failed++
+					continue
+				}
+				verified[token.Id] = key
+				backfilled++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return backfilled, 0, err
+	}
+	if failed > 0 {
+		return backfilled, 0, fmt.Errorf("%d 个令牌回填 key_hash 失败，未清空明文 key", failed)
+	}
+
+	// 明文 key 与回填时一致才清空，迁移期间新增或轮换的令牌保留明文 key，可重复执行迁移处理
+	for id, key := range verified {
+		result := DB.Model(&TokenEnhanced{}).
+			Where("id = ? AND "+commonKeyCol+" = ? AND key_hash = ?", id, key, common.GenerateHMAC(key)).
+			Update("key", gorm.Expr("NULL"))
+		if result.Error != nil {
+			return backfilled, cleared, result.Error
+		}
+		cleared += result.RowsAffected
+	}
+	return backfilled, cleared, nil
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"relay-gateway/common"
+
+	"gorm.io/gorm"
+)
+
+// 令牌生命周期：IsExpired、HasQuotaRemaining 只在读取时判断，由主节点定期将已过期、额度耗尽的令牌
+// 写回对应状态并清除 Redis 和本地缓存，避免缓存中的令牌在过期后继续可用
+
+// tokenLifecycleColumns 状态流转和清除缓存需要的列
+var tokenLifecycleColumns = []string{"id", "key", "key_hash", "previous_key_hash"}
+
+// SweepExpiredTokens 将已过期但仍为启用状态的令牌置为过期，返回更新的令牌数
+func SweepExpiredTokens() (int, error) {
+	return sweepTokenStatus(common.TokenStatusExpired, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now())
+	})
+}
+
+// SweepExhaustedTokens 将额度已用尽但仍为启用状态的令牌置为耗尽，返回更新的令牌数
+func SweepExhaustedTokens() (int, error) {
+	return sweepTokenStatus(common.TokenStatusExhausted, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("unlimited_quota = ? AND remain_quota <= ?", false, 0)
+	})
+}
+
+// sweepTokenStatus 逐个更新满足条件的启用令牌，更新时重复校验条件，避免覆盖查询后被修改的令牌
+func sweepTokenStatus(status int, cond func(tx *gorm.DB) *gorm.DB) (swept int, err error) {
+	var tokens []*TokenEnhanced
+	err = cond(DB.Model(&TokenEnhanced{}).Select(tokenLifecycleColumns).
+		Where("status = ? AND deleted = ?", common.TokenStatusEnabled, 0)).
+		FindInBatches(&tokens, 200, func(tx *gorm.DB, batch int) error {
+			for _, token := range tokens {
+				result := cond(DB.Model(&TokenEnhanced{}).
+					Where("id = ? AND status = ? AND deleted = ?", token.Id, common.TokenStatusEnabled, 0)).
+					Updates(map[string]interface{}{
+						"status":     status,
+						"updated_at": time.Now(),
+					})
+				if result.Error != nil {
+					common.SysLog(fmt.Sprintf("failed to update token status: token_id=%s, status=%d, error=%v", token.Id, status, result.Error))
+					continue
+				}
+				if result.RowsAffected == 0 {
+					continue
+				}
+				invalidateTokenEnhancedCache(token)
+				swept++
+			}
+			return nil
+		}).Error
+	return swept, err
+}
+
+// restoreTokenEnhancedStatus 修改过期时间或额度后，过期、耗尽状态的令牌如已恢复可用则重新启用
+func restoreTokenEnhancedStatus(token *TokenEnhanced) error {
+	switch token.Status {
+	case common.TokenStatusExpired:
+		if token.ExpiresAt != nil && !token.ExpiresAt.After(time.Now()) {
+			return nil
+		}
+	case common.TokenStatusExhausted:
+		if !token.HasQuotaRemaining() {
+			return nil
+		}
+	default:
+		return nil
+	}
+	err := DB.Model(&TokenEnhanced{}).Where("id = ? AND status = ?", token.Id, token.Status).
+		Update("status", common.TokenStatusEnabled).Error
+	if err != nil {
+		return err
+	}
+	token.Status = common.TokenStatusEnabled
+	invalidateTokenEnhancedCache(token)
+	return nil
+}
+
+// GetTokensExpiringWithin 查询将在 d 内过期且尚未发送过期提醒的启用令牌
+func GetTokensExpiringWithin(d time.Duration) (tokens []*TokenEnhanced, err error) {
+	now := time.Now()
+	err = DB.Select("id", "user_id", "name", "display_key", "expires_at").
+		Where("status = ? AND deleted = ?", common.TokenStatusEnabled, 0).
+		Where("expires_at > ? AND expires_at <= ? AND expiry_notified_at IS NULL", now, now.Add(d)).
+		Order("expires_at").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// MarkTokenExpiryNotified 记录已发送过期提醒，修改过期时间后会被清空
+func MarkTokenExpiryNotified(id string) error {
+	return DB.Model(&TokenEnhanced{}).Where("id = ?", id).Update("expiry_notified_at", time.Now()).Error
+}
@@ -0,0 +1,204 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"relay-gateway/common"
+)
+
+// 管理 API 使用的令牌增删改查，所有写操作完成后都会按 key 哈希清除缓存
+
+var (
+	ErrTokenEnhancedExpired   = errors.New("令牌已过期，无法启用，请先修改过期时间")
+	ErrTokenEnhancedExhausted = errors.New("令牌额度已用尽，无法启用，请先修改剩余额度")
+)
+
+// TokenEnhancedSearchParams 令牌查询条件，空值表示不过滤
+type TokenEnhancedSearchParams struct {
+	UserId  string
+	Keyword string // 匹配名称、key 前缀或展示 key
+	Status  int
+	Group   string
+}
+
+// cacheKeyHashes 令牌当前可能使用的所有缓存键哈希：当前 key、轮换前的旧 key、未迁移的明文 key
+func (token *TokenEnhanced) cacheKeyHashes() []string {
+	hashes := make([]string, 0, 3)
+	if token.KeyHash != "" {
+		hashes = append(hashes, token.KeyHash)
+	}
+	if token.PreviousKeyHash != nil && *token.PreviousKeyHash != "" {
+		hashes = append(hashes, *token.PreviousKeyHash)
+	}
+	if token.Key != "" {
+		if hmacKey := common.GenerateHMAC(token.Key); hmacKey != token.KeyHash {
+			hashes = append(hashes, hmacKey)
+		}
+	}
+	return hashes
+}
+
+func invalidateTokenEnhancedCache(token *TokenEnhanced) {
+	for _, hmacKey := range token.cacheKeyHashes() {
+		if err := CacheDeleteTokenEnhancedByHash(hmacKey); err != nil {
+			common.SysLog(fmt.Sprintf("[TokenCache] delete cache FAILED for token_id=%s, error=%v", token.Id, err))
+		}
+	}
+	// 子令牌按 id 读取父令牌
+	invalidateTokenEnhancedIdCache(token.Id)
+}
+
+// CacheDeleteTokenEnhancedById 按令牌 id 删除其所有 key 哈希的 Redis 缓存和本地缓存并通知其他节点，
+// 用于直接修改数据库后使令牌立即生效；已删除的令牌同样处理
+func CacheDeleteTokenEnhancedById(id string) error {
+	token := &TokenEnhanced{}
+	err := DB.Select(tokenLifecycleColumns).Where("id = ?", id).First(token).Error
+	if err != nil {
+		invalidateTokenEnhancedIdCache(id)
+		return err
+	}
+	invalidateTokenEnhancedCache(token)
+	return nil
+}
+
+// CreateTokenEnhanced 生成新 key 并创建令牌，返回的明文 key 不会保存，只能返回给调用方一次
+func CreateTokenEnhanced(token *TokenEnhanced) (key string, err error) {
+	if token.UserId == "" {
+		return "", errors.New("user_id 为空！")
+	}
+	if token.Name == "" {
+		return "", errors.New("name 为空！")
+	}
+	if err = CheckTokenKeyHashSecret(); err != nil {
+		return "", err
+	}
+	key, err = common.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	token.Id = common.GetUUID()
+	token.Key = ""
+	token.FillKeyFields(key)
+	token.PreviousKeyHash = nil
+	token.PreviousKeyExpiresAt = nil
+	if token.Status == 0 {
+		token.Status = common.TokenStatusEnabled
+	}
+	token.Deleted = 0
+	now := time.Now()
+	token.CreatedAt = &now
+	token.UpdatedAt = &now
+	// Select("*") 写入零值（如 0 表示不限制），否则会被数据库默认值覆盖；明文 key 列保持 NULL
+	err = DB.Select("*").Omit("key").Create(token).Error
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// GetTokenEnhancedById 按 id 查询未删除的令牌
+func GetTokenEnhancedById(id string) (*TokenEnhanced, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	token := &TokenEnhanced{}
+	err := DB.Where("id = ? AND deleted = ?", id, 0).First(token).Error
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// SearchTokensEnhanced 分页查询未删除的令牌，按创建时间倒序
+func SearchTokensEnhanced(params TokenEnhancedSearchParams, startIdx int, num int) (tokens []*TokenEnhanced, total int64, err error) {
+	tx := DB.Model(&TokenEnhanced{}).Where("deleted = ?", 0)
+	if params.UserId != "" {
+		tx = tx.Where("user_id = ?", params.UserId)
+	}
+	if params.Keyword != "" {
+		tx = tx.Where("name LIKE ? OR key_prefix LIKE ? OR display_key = ?", "%"+params.Keyword+"%", params.Keyword+"%", params.Keyword)
+	}
+	if params.Status != 0 {
+		tx = tx.Where("status = ?", params.Status)
+	}
+	if params.Group != "" {
+		tx = tx.Where(commonGroupCol+" = ?", params.Group)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("created_at desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return tokens, total, nil
+}
+
+// UpdateTokenEnhancedById 按列名更新令牌并清除缓存，返回更新后的令牌
+func UpdateTokenEnhancedById(id string, updates map[string]interface{}) (*TokenEnhanced, error) {
+	token, err := GetTokenEnhancedById(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(updates) == 0 {
+		return token, nil
+	}
+	if _, ok := updates["expires_at"]; ok {
+		updates["expiry_notified_at"] = nil
+	}
+	updates["updated_at"] = time.Now()
+	err = DB.Model(&TokenEnhanced{}).Where("id = ? AND deleted = ?", id, 0).Updates(updates).Error
+	if err != nil {
+		return nil, err
+	}
+	invalidateTokenEnhancedCache(token)
+	token, err = GetTokenEnhancedById(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := updates["status"]; !ok {
+		if err = restoreTokenEnhancedStatus(token); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// SetTokenEnhancedStatus 启用或禁用令牌
+func SetTokenEnhancedStatus(id string, status int) (*TokenEnhanced, error) {
+	if status != common.TokenStatusEnabled && status != common.TokenStatusDisabled {
+		return nil, errors.New("只能设置为启用或禁用")
+	}
+	if status == common.TokenStatusEnabled {
+		token, err := GetTokenEnhancedById(id)
+		if err != nil {
+			return nil, err
+		}
+		if token.ExpiresAt != nil && !token.ExpiresAt.After(time.Now()) {
+			return nil, ErrTokenEnhancedExpired
+		}
+		if !token.HasQuotaRemaining() {
+			return nil, ErrTokenEnhancedExhausted
+		}
+	}
+	return UpdateTokenEnhancedById(id, map[string]interface{}{"status": status})
+}
+
+// DeleteTokenEnhancedById 软删除令牌并清除缓存
+func DeleteTokenEnhancedById(id string) error {
+	token, err := GetTokenEnhancedById(id)
+	if err != nil {
+		return err
+	}
+	err = DB.Model(&TokenEnhanced{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted":    1,
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	invalidateTokenEnhancedCache(token)
+	return nil
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+)
+
+// GetPreviousKeyRemaining 判断 key 是否为轮换前的旧 key，是则返回旧 key 的剩余有效时间
+func (token *TokenEnhanced) GetPreviousKeyRemaining(key string) (time.Duration, bool) {
+	if token.PreviousKeyHash == nil || *token.PreviousKeyHash == "" {
+		return 0, false
+	}
+	hmacKey := common.GenerateHMAC(key)
+	if hmacKey == token.KeyHash || hmacKey != *token.PreviousKeyHash {
+		return 0, false
+	}
+	if token.PreviousKeyExpiresAt == nil {
+		return 0, true
+	}
+	return time.Until(*token.PreviousKeyExpiresAt), true
+}
+
+// cacheTTL 缓存时间不超过令牌过期时间；通过旧 key 缓存的令牌，缓存时间也不超过宽限期截止时间，
+// 确保令牌过期、旧 key 到期后缓存同步失效
+func (token *TokenEnhanced) cacheTTL(hmacKey string, ttl time.Duration) time.Duration {
+	deadlines := make([]time.Time, 0, 2)
+	if token.ExpiresAt != nil {
+		deadlines = append(deadlines, *token.ExpiresAt)
+	}
+	if token.PreviousKeyHash != nil && *token.PreviousKeyHash == hmacKey && hmacKey != token.KeyHash && token.PreviousKeyExpiresAt != nil {
+		deadlines = append(deadlines, *token.PreviousKeyExpiresAt)
+	}
+	for _, deadline := range deadlines {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return time.Second
+		}
+		if remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl
+}
+
+// CacheDeleteTokenEnhancedByHash 按 key 哈希删除 Redis 缓存和本地缓存（明文 key 不可得时使用），
+// 旧版 Token 同样读取 t_api_keys，其缓存一并删除
+func CacheDeleteTokenEnhancedByHash(hmacKey string) error {
+	cacheKey := fmt.Sprintf("token_enhanced:%s", hmacKey)
+	tokenLocalCache.Delete(cacheKey)
+	if !common.RedisEnabled {
+		return nil
+	}
+	err := common.RedisDelKey(cacheKey)
+	if legacyErr := common.RedisDelKey(fmt.Sprintf("token:%s", hmacKey)); err == nil {
+		err = legacyErr
+	}
+	// 两个 Redis 缓存都删除后再通知其他节点
+	PublishCacheInvalidation(CacheInvalidationToken, hmacKey)
+	return err
+}
+
+// RotateTokenEnhancedKey 为令牌生成新的 key，令牌 id、额度和各项限制保持不变，
+// 旧 key 在 gracePeriod 内仍然有效，gracePeriod 为 0 时旧 key 立即失效，
+// 其他节点本地缓存中轮换前的令牌由缓存失效通知清除。
+// 再次轮换时，上一次轮换留下的旧 key 会立即失效
+func RotateTokenEnhancedKey(id string, gracePeriod time.Duration) (newKey string, token *TokenEnhanced, err error) {
+	if id == "" {
+		return "", nil, errors.New("id 为空！")
+	}
+	if gracePeriod < 0 {
+		return "", nil, errors.New("宽限期不能为负数")
+	}
+	if err = CheckTokenKeyHashSecret(); err != nil {
+		return "", nil, err
+	}
+	token = &TokenEnhanced{}
+	err = DB.Where("id = ? AND deleted = ?", id, 0).First(token).Error
+	if err != nil {
+		return "", nil, err
+	}
+
+	newKey, err = common.GenerateKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	previousKeyHash := token.KeyHash
+	if token.Key != "" {
+		// 尚未迁移的旧数据，以明文 key 计算哈希为准
+		previousKeyHash = common.GenerateHMAC(token.Key)
+	}
+	staleHashes := token.cacheKeyHashes()
+
+	previousKeyExpiresAt := time.Now().Add(gracePeriod)
+	token.PreviousKeyHash = &previousKeyHash
+	token.PreviousKeyExpiresAt = &previousKeyExpiresAt
+	token.FillKeyFields(newKey)
+	now := time.Now()
+	token.UpdatedAt = &now
+	// 明文 key 列一并置空，避免轮换后的旧 key 仍以明文保存
+	err = DB.Model(&TokenEnhanced{}).Where("id = ?", token.Id).Updates(map[string]interface{}{
+		"key":                     nil,
+		"key_hash":                token.KeyHash,
+		"key_prefix":              token.KeyPrefix,
+		"display_key":             token.DisplayKey,
+		"previous_key_hash":       token.PreviousKeyHash,
+		"previous_key_expires_at": token.PreviousKeyExpiresAt,
+		"updated_at":              token.UpdatedAt,
+	}).Error
+	if err != nil {
+		return "", nil, err
+	}
+	token.Key = ""
+
+	// 删除旧 key 的缓存，下次访问时从数据库加载带有宽限期信息的令牌
+	for _, hmacKey := range staleHashes {
+		if cacheErr := CacheDeleteTokenEnhancedByHash(hmacKey); cacheErr != nil {
+			common.SysLog(fmt.Sprintf("[TokenCache] delete rotated key cache FAILED for token_id=%s, error=%v", token.Id, cacheErr))
+		}
+	}
+	// 子令牌按 id 读取父令牌，需要重新加载轮换后的 key 哈希
+	invalidateTokenEnhancedIdCache(token.Id)
+	common.SysLog(fmt.Sprintf("[TokenCache] token key rotated, token_id=%s, previous key expires at %s", token.Id, previousKeyExpiresAt.Format(time.RFC3339)))
+	return newKey, token, nil
+}
+
+// GetTokenRotationGracePeriod 默认轮换宽限期
+func GetTokenRotationGracePeriod() time.Duration {
+	return time.Duration(constant.TokenRotationGracePeriodSeconds) * time.Second
+}
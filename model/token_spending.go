@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+)
+
+// 令牌消费计数：按自然日/自然月累计每个令牌的实际消费额度，
+// 启用 Redis 时多节点共享计数，否则仅在本节点内存中累计（重启后清零）
+
+var (
+	tokenSpendingLocation     *time.Location
+	tokenSpendingLocationOnce sync.Once
+
+	tokenSpendingMemory     = make(map[string]*tokenSpendingCounter)
+	tokenSpendingMemoryLock sync.Mutex
+)
+
+type tokenSpendingCounter struct {
+	Day     string
+	Month   string
+	Daily   int
+	Monthly int
+}
+
+func getTokenSpendingLocation() *time.Location {
+	tokenSpendingLocationOnce.Do(func() {
+		tokenSpendingLocation = time.Local
+		loc, err := time.LoadLocation(constant.TokenSpendingTimezone)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to load TOKEN_SPENDING_TIMEZONE %s: %s, using local timezone", constant.TokenSpendingTimezone, err.Error()))
+			return
+		}
+		tokenSpendingLocation = loc
+	})
+	return tokenSpendingLocation
+}
+
+// tokenSpendingPeriods 返回当前自然日、自然月的标识及结束时间
+func tokenSpendingPeriods(now time.Time) (day string, dayEnd time.Time, month string, monthEnd time.Time) {
+	now = now.In(getTokenSpendingLocation())
+	y, m, d := now.Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	return dayStart.Format("20060102"), dayStart.AddDate(0, 0, 1), monthStart.Format("200601"), monthStart.AddDate(0, 1, 0)
+}
+
+func getTokenSpendingCacheKeys(tokenId string, day string, month string) (string, string) {
+	return fmt.Sprintf("token_spending:daily:%s:%s", tokenId, day), fmt.Sprintf("token_spending:monthly:%s:%s", tokenId, month)
+}
+
+// getTokenSpendingCounter 获取内存计数器，跨自然日/月时重置对应计数，调用方需持有锁
+func getTokenSpendingCounter(tokenId string, day string, month string) *tokenSpendingCounter {
+	counter, ok := tokenSpendingMemory[tokenId]
+	if !ok {
+		counter = &tokenSpendingCounter{Day: day, Month: month}
+		tokenSpendingMemory[tokenId] = counter
+	}
+	if counter.Day != day {
+		counter.Day = day
+		counter.Daily = 0
+	}
+	if counter.Month != month {
+		counter.Month = month
+		counter.Monthly = 0
+	}
+	return counter
+}
+
+// IncreaseTokenSpending 累加令牌当日、当月消费额度，quota 为负数表示退还
+func IncreaseTokenSpending(tokenId string, quota int) {
+	IncreaseTokenSpendingAt(tokenId, quota, time.Now())
+}
+
+// IncreaseTokenSpendingAt 按扣费时间 chargedAt 所在的自然日、自然月调整消费额度，用于退还之前的扣费：
+// 扣费所在的日、月已经结束时，对应计数不再调整，避免退款抵扣当前周期的消费
+func IncreaseTokenSpendingAt(tokenId string, quota int, chargedAt time.Time) {
+	if tokenId == "" || quota == 0 {
+		return
+	}
+	day, dayEnd, month, monthEnd := tokenSpendingPeriods(time.Now())
+	chargedDay, _, chargedMonth, _ := tokenSpendingPeriods(chargedAt)
+	updateDaily := chargedDay == day
+	updateMonthly := chargedMonth == month
+	if common.RedisEnabled {
+		dailyKey, monthlyKey := getTokenSpendingCacheKeys(tokenId, day, month)
+		// 周期结束后再保留一天，避免边界时刻读写不一致
+		if updateDaily {
+			if _, err := common.RedisIncrByExpireAt(dailyKey, int64(quota), dayEnd.Add(24*time.Hour)); err != nil {
+				common.SysLog(fmt.Sprintf("failed to increase token daily spending: token_id=%s, quota=%d, error=%v", tokenId, quota, err))
+			}
+		}
+		if updateMonthly {
+			if _, err := common.RedisIncrByExpireAt(monthlyKey, int64(quota), monthEnd.Add(24*time.Hour)); err != nil {
+				common.SysLog(fmt.Sprintf("failed to increase token monthly spending: token_id=%s, quota=%d, error=%v", tokenId, quota, err))
+			}
+		}
+		return
+	}
+
+	tokenSpendingMemoryLock.Lock()
+	defer tokenSpendingMemoryLock.Unlock()
+	counter := getTokenSpendingCounter(tokenId, day, month)
+	if updateDaily {
+		counter.Daily += quota
+	}
+	if updateMonthly {
+		counter.Monthly += quota
+	}
+}
+
+// GetTokenSpending 获取令牌当日、当月已消费额度
+func GetTokenSpending(tokenId string) (daily int, monthly int, err error) {
+	day, _, month, _ := tokenSpendingPeriods(time.Now())
+	if common.RedisEnabled {
+		dailyKey, monthlyKey := getTokenSpendingCacheKeys(tokenId, day, month)
+		dailySpent, err := common.RedisGetInt64(dailyKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		monthlySpent, err := common.RedisGetInt64(monthlyKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		return int(dailySpent), int(monthlySpent), nil
+	}
+
+	tokenSpendingMemoryLock.Lock()
+	defer tokenSpendingMemoryLock.Unlock()
+	counter := getTokenSpendingCounter(tokenId, day, month)
+	return counter.Daily, counter.Monthly, nil
+}
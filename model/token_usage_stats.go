@@ -0,0 +1,105 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// 令牌使用统计：请求数、token 数、消费（额度，即美分）和最后使用时间先在内存中按令牌聚合，
+// 由后台协程定期以增量方式批量写入 t_api_keys，避免每次请求都写数据库。
+// 各节点独立聚合，写入时使用 total_xxx = total_xxx + ?，多节点之间不会相互覆盖
+
+type tokenUsageDelta struct {
+	Requests   int
+	Tokens     int
+	CostCents  int
+	LastUsedAt time.Time
+}
+
+var (
+	tokenUsageStore     = make(map[string]*tokenUsageDelta)
+	tokenUsageStoreLock sync.Mutex
+	tokenUsageFlushOnce sync.Once
+)
+
+// InitTokenUsageFlusher 启动令牌使用统计的定期写入，间隔与 BATCH_UPDATE_INTERVAL 相同
+func InitTokenUsageFlusher() {
+	tokenUsageFlushOnce.Do(func() {
+		gopool.Go(func() {
+			for {
+				time.Sleep(time.Duration(common.BatchUpdateInterval) * time.Second)
+				FlushTokenUsage()
+			}
+		})
+	})
+}
+
+// RecordTokenUsage 记录一次成功请求的 token 数和消费额度
+func RecordTokenUsage(tokenId string, tokens int, quota int) {
+	mergeTokenUsage(tokenId, &tokenUsageDelta{Requests: 1, Tokens: tokens, CostCents: quota, LastUsedAt: time.Now()})
+}
+
+// AdjustTokenUsageCost 调整令牌累计消费（如任务补扣费或退款），不计入请求数
+func AdjustTokenUsageCost(tokenId string, quotaDelta int) {
+	if quotaDelta == 0 {
+		return
+	}
+	mergeTokenUsage(tokenId, &tokenUsageDelta{CostCents: quotaDelta})
+}
+
+func mergeTokenUsage(tokenId string, delta *tokenUsageDelta) {
+	if tokenId == "" {
+		return
+	}
+	tokenUsageStoreLock.Lock()
+	defer tokenUsageStoreLock.Unlock()
+	current, ok := tokenUsageStore[tokenId]
+	if !ok {
+		current = &tokenUsageDelta{}
+		tokenUsageStore[tokenId] = current
+	}
+	current.Requests += delta.Requests
+	current.Tokens += delta.Tokens
+	current.CostCents += delta.CostCents
+	if delta.LastUsedAt.After(current.LastUsedAt) {
+		current.LastUsedAt = delta.LastUsedAt
+	}
+}
+
+// FlushTokenUsage 将内存中聚合的使用统计写入数据库，写入失败的增量会合并回内存等待下次写入
+func FlushTokenUsage() {
+	tokenUsageStoreLock.Lock()
+	store := tokenUsageStore
+	tokenUsageStore = make(map[string]*tokenUsageDelta)
+	tokenUsageStoreLock.Unlock()
+	if len(store) == 0 {
+		return
+	}
+
+	failed := 0
+	for tokenId, delta := range store {
+		updates := map[string]interface{}{
+			"total_requests":   gorm.Expr("total_requests + ?", delta.Requests),
+			"total_tokens":     gorm.Expr("total_tokens + ?", delta.Tokens),
+			"total_cost_cents": gorm.Expr("total_cost_cents + ?", delta.CostCents),
+		}
+		if !delta.LastUsedAt.IsZero() {
+			updates["last_used_at"] = delta.LastUsedAt
+		}
+		err := DB.Model(&TokenEnhanced{}).Where("id = ?", tokenId).Updates(updates).Error
+		if err != nil {
+			failed++
+			common.SysLog(fmt.Sprintf("failed to flush token usage: token_id=%s, error=%v", tokenId, err))
+			mergeTokenUsage(tokenId, delta)
+		}
+	}
+	if failed > 0 {
+		common.SysLog(fmt.Sprintf("token usage flush finished, %d/%d failed", failed, len(store)))
+	}
+}
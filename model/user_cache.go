@@ -43,11 +43,18 @@ func invalidateUserCache(userId string) error {
 	// 同步删除本地缓存
 	LocalCacheDeleteUser(userId)
 
-	// 删除 Redis 缓存
+	// 删除 Redis 缓存，完成后再通知其他节点
 	if !common.RedisEnabled {
 		return nil
 	}
-	return common.RedisDelKey(getUserCacheKey(userId))
+	err := common.RedisDelKey(getUserCacheKey(userId))
+	PublishCacheInvalidation(CacheInvalidationUser, userId)
+	return err
+}
+
+// CacheDeleteUser 删除用户的本地缓存和 Redis 缓存，并通知其他节点
+func CacheDeleteUser(userId string) error {
+	return invalidateUserCache(userId)
 }
 
 // updateUserCache updates all user cache fields using JSON
@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"relay-gateway/common"
+	"relay-gateway/dto"
 	"time"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -246,3 +247,22 @@ func GetUsernameById(id string, fromDB bool) (username string, err error) {
 
 	return username, nil
 }
+
+// GetUserNotifyInfo 获取用户邮箱和通知设置（t_users.setting，JSON 格式的 dto.UserSetting），
+// 未配置通知设置时返回空设置，按邮件通知
+func GetUserNotifyInfo(userId string) (email string, setting dto.UserSetting, err error) {
+	var row struct {
+		Email   string
+		Setting *string
+	}
+	err = DB.Table("t_users").Select("email", "setting").Where("id = ?", userId).Take(&row).Error
+	if err != nil {
+		return "", setting, err
+	}
+	if row.Setting != nil && *row.Setting != "" {
+		if err := common.UnmarshalJsonStr(*row.Setting, &setting); err != nil {
+			common.SysLog("failed to unmarshal user setting: user_id=" + userId + ", error=" + err.Error())
+		}
+	}
+	return row.Email, setting, nil
+}
@@ -284,6 +284,10 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	if info.Hedge != nil {
+		// 对冲请求中落败的尝试需要取消上游请求
+		req = req.WithContext(c.Request.Context())
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.LogError(c, "do request failed: "+err.Error())
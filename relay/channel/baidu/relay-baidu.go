@@ -135,6 +135,9 @@ func baiduStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.
 		return true
 	})
 	service.CloseResponseBodyGracefully(resp)
+	if newAPIError := helper.StreamFailureError(c, info); newAPIError != nil {
+		return newAPIError, nil
+	}
 	return nil, usage
 }
 
@@ -719,6 +719,9 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 	if err != nil {
 		return nil, err
 	}
+	if newAPIError := helper.StreamFailureError(c, info); newAPIError != nil {
+		return nil, newAPIError
+	}
 
 	HandleStreamFinalResponse(c, info, claudeInfo, requestMode)
 	return claudeInfo.Usage, nil
@@ -244,6 +244,9 @@ func difyStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		}
 		return true
 	})
+	if newAPIError := helper.StreamFailureError(c, info); newAPIError != nil {
+		return nil, newAPIError
+	}
 	helper.Done(c)
 	if usage.TotalTokens == 0 {
 		usage = service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
@@ -147,6 +147,9 @@ func GeminiTextGenerationStreamHandler(c *gin.Context, info *relaycommon.RelayIn
 		info.SendResponseCount++
 		return true
 	})
+	if newAPIError := helper.StreamFailureError(c, info); newAPIError != nil {
+		return nil, newAPIError
+	}
 
 	if info.SendResponseCount == 0 {
 		return nil, types.NewOpenAIError(errors.New("no response received from Gemini API"), types.ErrorCodeEmptyResponse, http.StatusInternalServerError)
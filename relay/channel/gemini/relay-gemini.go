@@ -1007,6 +1007,9 @@ func GeminiChatStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *
 		}
 		return true
 	})
+	if newAPIError := helper.StreamFailureError(c, info); newAPIError != nil {
+		return nil, newAPIError
+	}
 
 	if info.SendResponseCount == 0 {
 		// 空补全，报错不计费
@@ -145,6 +145,9 @@ func OaiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Re
 		}
 		return true
 	})
+	if newAPIError := helper.StreamFailureError(c, info); newAPIError != nil {
+		return nil, newAPIError
+	}
 
 	// 对音频模型，从倒数第二个stream data中提取usage信息
 	if isAudioModel && secondLastStreamData != "" {
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"sync"
+)
+
+// HedgeGate 一次对冲请求中各尝试共享的结果，只有胜出的尝试计费
+type HedgeGate struct {
+	once     sync.Once
+	decided  chan struct{}
+	winner   int
+	channels []string
+}
+
+// HedgeAttempt 对冲请求中的一次尝试，Index 为 0 的是首个请求，1 为对冲请求
+type HedgeAttempt struct {
+	Gate  *HedgeGate
+	Index int
+}
+
+func NewHedgeGate() *HedgeGate {
+	return &HedgeGate{
+		decided: make(chan struct{}),
+		winner:  -1,
+	}
+}
+
+// AddChannel 记录发起尝试的渠道
+func (g *HedgeGate) AddChannel(channelId string) {
+	g.channels = append(g.channels, channelId)
+}
+
+// Channels 按发起顺序返回各尝试的渠道
+func (g *HedgeGate) Channels() []string {
+	return g.channels
+}
+
+// Resolve 确定胜出的尝试，只有第一次调用生效；所有尝试都失败时传入 -1
+func (g *HedgeGate) Resolve(winner int) {
+	g.once.Do(func() {
+		g.winner = winner
+		close(g.decided)
+	})
+}
+
+// Winner 等待结果确定并返回胜出的尝试
+func (g *HedgeGate) Winner() int {
+	<-g.decided
+	return g.winner
+}
+
+// Lost 结果已确定且不是当前尝试胜出，不阻塞
+func (a *HedgeAttempt) Lost() bool {
+	select {
+	case <-a.Gate.decided:
+		return a.Gate.winner != a.Index
+	default:
+		return false
+	}
+}
+
+// ShouldBill 是否对本次请求计费。对冲请求的计费在异步任务中执行，等待结果确定后只有胜出的尝试计费
+func (info *RelayInfo) ShouldBill() bool {
+	if info.Hedge == nil {
+		return true
+	}
+	return info.Hedge.Gate.Winner() == info.Hedge.Index
+}
+
+// CloneForHedge 复制一份用于对冲尝试的 RelayInfo，尝试过程中会修改的字段各自独立
+func (info *RelayInfo) CloneForHedge(gate *HedgeGate, index int) *RelayInfo {
+	clone := *info
+	clone.Hedge = &HedgeAttempt{Gate: gate, Index: index}
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		clone.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		responsesUsageInfo := *info.ResponsesUsageInfo
+		clone.ResponsesUsageInfo = &responsesUsageInfo
+	}
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		clone.ChannelMeta = &channelMeta
+	}
+	return &clone
+}
@@ -58,6 +58,7 @@ type ChannelMeta struct {
 	ChannelId            string
 	ChannelIsMultiKey    bool
 	ChannelMultiKeyIndex int
+	ChannelMultiKeyMode  constant.MultiKeyMode
 	ChannelBaseUrl       string
 	ApiType              int
 	ApiVersion           string
@@ -80,6 +81,7 @@ type RelayInfo struct {
 	UsingGroup        string // 使用的分组
 	UserGroup         string // 用户所在分组
 	TokenUnlimited    bool
+	ChildTokenId      string // 通过子令牌（JWT）访问时为其 jti，费用计入父令牌
 	StartTime         time.Time
 	FirstResponseTime time.Time
 	isFirstResponse   bool
@@ -90,6 +92,7 @@ type RelayInfo struct {
 	UsePrice               bool
 	RelayMode              int
 	OriginModelName        string
+	FallbackFromModel      string // 降级前请求的模型，未降级时为空
 	RequestURLPath         string
 	PromptTokens           int
 	ShouldIncludeUsage     bool
@@ -107,13 +110,16 @@ type RelayInfo struct {
 	UserQuota              int
 	RelayFormat            types.RelayFormat
 	SendResponseCount      int
-	FinalPreConsumedQuota  int  // 最终预消耗的配额
-	IsClaudeBetaQuery      bool // /v1/messages?beta=true
+	StreamError            error // 流式响应异常结束（连接错误、空响应、首字超时、中途超时）的原因，正常结束时为 nil
+	FinalPreConsumedQuota  int   // 最终预消耗的配额
+	IsClaudeBetaQuery      bool  // /v1/messages?beta=true
 
 	PriceData types.PriceData
 
 	Request dto.Request
 
+	Hedge *HedgeAttempt // 对冲请求的尝试信息，未对冲时为 nil
+
 	ThinkingContentInfo
 	*ClaudeConvertInfo
 	*RerankerInfo
@@ -132,6 +138,7 @@ func (info *RelayInfo) InitChannelMeta(c *gin.Context) {
 		ChannelId:            common.GetContextKeyString(c, constant.ContextKeyChannelId),
 		ChannelIsMultiKey:    common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey),
 		ChannelMultiKeyIndex: common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex),
+		ChannelMultiKeyMode:  constant.MultiKeyMode(common.GetContextKeyString(c, constant.ContextKeyChannelMultiKeyMode)),
 		ChannelBaseUrl:       common.GetContextKeyString(c, constant.ContextKeyChannelBaseUrl),
 		ApiType:              apiType,
 		ApiVersion:           c.GetString("api_version"),
@@ -396,6 +403,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenId:        common.GetContextKeyString(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
+		ChildTokenId:   common.GetContextKeyString(c, constant.ContextKeyChildTokenId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
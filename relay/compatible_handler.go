@@ -199,6 +199,10 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 }
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	// 对冲请求只对胜出的尝试计费
+	if !relayInfo.ShouldBill() {
+		return
+	}
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -401,6 +405,11 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.RecordChannelKeyUsage(relayInfo.ChannelId, relayInfo.ChannelMultiKeyMode, relayInfo.ChannelMultiKeyIndex, quota)
+		model.ReconcileChannelBudget(relayInfo.ChannelId, relayInfo.OriginModelName, relayInfo.PromptTokens, totalTokens)
+		model.IncreaseTokenSpending(relayInfo.TokenId, quota)
+		model.IncreaseChildTokenSpending(relayInfo.ChildTokenId, quota)
+		model.RecordTokenUsage(relayInfo.TokenId, totalTokens, quota)
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -441,6 +450,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		logContent += ", " + extraContent
 	}
 	other := service.GenerateTextOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio, cacheTokens, cacheRatio, modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	service.AppendPromptCacheInfo(ctx, other, usage.PromptTokens, cacheTokens)
 	if imageTokens != 0 {
 		other["image"] = true
 		other["image_ratio"] = imageRatio
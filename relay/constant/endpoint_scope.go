@@ -0,0 +1,85 @@
+package constant
+
+import "strings"
+
+// 令牌可授权的接口范围，带层级的范围（如 audio.speech）可通过上级范围（audio）整体授权
+const (
+	EndpointScopeChat               = "chat" // chat/completions、completions、responses、messages、Gemini generateContent
+	EndpointScopeEmbeddings         = "embeddings"
+	EndpointScopeImages             = "images"
+	EndpointScopeAudioSpeech        = "audio.speech"
+	EndpointScopeAudioTranscription = "audio.transcription"
+	EndpointScopeAudioTranslation   = "audio.translation"
+	EndpointScopeRerank             = "rerank"
+	EndpointScopeModerations        = "moderations"
+	EndpointScopeRealtime           = "realtime"
+	EndpointScopeVideo              = "video"
+	EndpointScopeChildTokens        = "tokens" // 签发子令牌
+)
+
+var endpointScopes = []string{
+	EndpointScopeChat,
+	EndpointScopeEmbeddings,
+	EndpointScopeImages,
+	EndpointScopeAudioSpeech,
+	EndpointScopeAudioTranscription,
+	EndpointScopeAudioTranslation,
+	EndpointScopeRerank,
+	EndpointScopeModerations,
+	EndpointScopeRealtime,
+	EndpointScopeVideo,
+	EndpointScopeChildTokens,
+}
+
+// IsValidEndpointScope 是否为已知的接口范围或其上级范围，* 表示全部
+func IsValidEndpointScope(scope string) bool {
+	if scope == "*" {
+		return true
+	}
+	for _, s := range endpointScopes {
+		if s == scope || strings.HasPrefix(s, scope+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Path2EndpointScope 根据请求路径判断所属的接口范围，无法识别时返回空字符串
+func Path2EndpointScope(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/v1/messages"):
+		return EndpointScopeChat
+	case strings.HasPrefix(path, "/v1/videos"), strings.HasPrefix(path, "/v1/video/"):
+		return EndpointScopeVideo
+	case strings.HasPrefix(path, "/v1/tokens/"):
+		return EndpointScopeChildTokens
+	}
+
+	switch Path2RelayMode(path) {
+	case RelayModeChatCompletions, RelayModeCompletions, RelayModeResponses:
+		return EndpointScopeChat
+	case RelayModeEmbeddings:
+		return EndpointScopeEmbeddings
+	case RelayModeImagesGenerations, RelayModeImagesEdits, RelayModeEdits:
+		return EndpointScopeImages
+	case RelayModeAudioSpeech:
+		return EndpointScopeAudioSpeech
+	case RelayModeAudioTranscription:
+		return EndpointScopeAudioTranscription
+	case RelayModeAudioTranslation:
+		return EndpointScopeAudioTranslation
+	case RelayModeRerank:
+		return EndpointScopeRerank
+	case RelayModeModerations:
+		return EndpointScopeModerations
+	case RelayModeRealtime:
+		return EndpointScopeRealtime
+	case RelayModeGemini:
+		// /v1beta/models/{model}:embedContent、:batchEmbedContents
+		if strings.Contains(path, ":embedContent") || strings.Contains(path, ":batchEmbedContents") {
+			return EndpointScopeEmbeddings
+		}
+		return EndpointScopeChat
+	}
+	return ""
+}
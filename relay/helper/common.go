@@ -8,6 +8,7 @@ import (
 	"relay-gateway/common"
 	"relay-gateway/dto"
 	"relay-gateway/logger"
+	relaycommon "relay-gateway/relay/common"
 	"relay-gateway/types"
 
 	"github.com/gin-gonic/gin"
@@ -94,6 +95,57 @@ func Done(c *gin.Context) {
 	_ = StringData(c, "[DONE]")
 }
 
+// StreamErrorEvent 流式响应已经开始后发生错误时，按客户端的格式发送错误事件，避免响应被静默截断
+func StreamErrorEvent(c *gin.Context, relayFormat types.RelayFormat, newAPIError *types.NewAPIError) {
+	// 每个响应只发送一次错误事件
+	if _, exists := c.Get("stream_error_event_sent"); exists {
+		return
+	}
+	c.Set("stream_error_event_sent", true)
+	switch relayFormat {
+	case types.RelayFormatClaude:
+		_ = ClaudeData(c, dto.ClaudeResponse{
+			Type:  "error",
+			Error: newAPIError.ToClaudeError(),
+		})
+	case types.RelayFormatGemini:
+		_ = ObjectData(c, gin.H{
+			"error": gin.H{
+				"code":    newAPIError.StatusCode,
+				"message": newAPIError.Error(),
+				"status":  "UNAVAILABLE",
+			},
+		})
+	default:
+		_ = ObjectData(c, gin.H{
+			"error": newAPIError.ToOpenAIError(),
+		})
+	}
+}
+
+// ResetEventStreamHeaders 流式响应尚未写出任何数据时清除已设置的 SSE 头部，便于重试其他渠道或返回 JSON 错误
+func ResetEventStreamHeaders(c *gin.Context) {
+	if c.Writer.Written() {
+		return
+	}
+	if _, exists := c.Get("event_stream_headers_set"); !exists {
+		return
+	}
+	delete(c.Keys, "event_stream_headers_set")
+	for _, key := range []string{"Content-Type", "Cache-Control", "Connection", "Transfer-Encoding", "X-Accel-Buffering"} {
+		c.Writer.Header().Del(key)
+	}
+}
+
+// StreamFailureError 流式响应在写出任何数据前异常结束时返回可重试的渠道错误，已写出数据或正常结束时返回 nil
+func StreamFailureError(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	if info.StreamError == nil || c.Writer.Written() {
+		return nil
+	}
+	ResetEventStreamHeaders(c)
+	return types.NewOpenAIError(info.StreamError, types.ErrorCodeStreamInterrupted, http.StatusBadGateway)
+}
+
 func WssString(c *gin.Context, ws *websocket.Conn, str string) error {
 	if ws == nil {
 		logger.LogError(c, "websocket connection is nil")
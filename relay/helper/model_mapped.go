@@ -15,41 +15,13 @@ func ModelMappedHelper(c *gin.Context, info *common.RelayInfo, request dto.Reque
 	// map model name
 	modelMapping := c.GetString("model_mapping")
 	if modelMapping != "" && modelMapping != "{}" {
-		modelMap := make(map[string]string)
-		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		upstreamModel, mapped, err := MapModelName(modelMapping, info.OriginModelName)
 		if err != nil {
-			return fmt.Errorf("unmarshal_model_mapping_failed")
+			return err
 		}
-
-		// 支持链式模型重定向，最终使用链尾的模型
-		currentModel := info.OriginModelName
-		visitedModels := map[string]bool{
-			currentModel: true,
-		}
-		for {
-			if mappedModel, exists := modelMap[currentModel]; exists && mappedModel != "" {
-				// 模型重定向循环检测，避免无限循环
-				if visitedModels[mappedModel] {
-					if mappedModel == currentModel {
-						if currentModel == info.OriginModelName {
-							info.IsModelMapped = false
-							return nil
-						} else {
-							info.IsModelMapped = true
-							break
-						}
-					}
-					return errors.New("model_mapping_contains_cycle")
-				}
-				visitedModels[mappedModel] = true
-				currentModel = mappedModel
-				info.IsModelMapped = true
-			} else {
-				break
-			}
-		}
-		if info.IsModelMapped {
-			info.UpstreamModelName = currentModel
+		info.IsModelMapped = mapped
+		if mapped {
+			info.UpstreamModelName = upstreamModel
 		}
 	}
 	if request != nil {
@@ -57,3 +29,43 @@ func ModelMappedHelper(c *gin.Context, info *common.RelayInfo, request dto.Reque
 	}
 	return nil
 }
+
+// MapModelName 按渠道的模型重定向配置解析上游模型名，返回上游模型名和是否发生了重定向
+func MapModelName(modelMapping string, modelName string) (string, bool, error) {
+	if modelMapping == "" || modelMapping == "{}" {
+		return modelName, false, nil
+	}
+	modelMap := make(map[string]string)
+	err := json.Unmarshal([]byte(modelMapping), &modelMap)
+	if err != nil {
+		return "", false, fmt.Errorf("unmarshal_model_mapping_failed")
+	}
+
+	// 支持链式模型重定向，最终使用链尾的模型
+	currentModel := modelName
+	mapped := false
+	visitedModels := map[string]bool{
+		currentModel: true,
+	}
+	for {
+		if mappedModel, exists := modelMap[currentModel]; exists && mappedModel != "" {
+			// 模型重定向循环检测，避免无限循环
+			if visitedModels[mappedModel] {
+				if mappedModel == currentModel {
+					if currentModel == modelName {
+						return modelName, false, nil
+					} else {
+						return currentModel, true, nil
+					}
+				}
+				return "", false, errors.New("model_mapping_contains_cycle")
+			}
+			visitedModels[mappedModel] = true
+			currentModel = mappedModel
+			mapped = true
+		} else {
+			break
+		}
+	}
+	return currentModel, mapped, nil
+}
@@ -3,11 +3,13 @@ package helper
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"relay-gateway/common"
@@ -15,6 +17,7 @@ import (
 	"relay-gateway/logger"
 	relaycommon "relay-gateway/relay/common"
 	"relay-gateway/setting/operation_setting"
+	"relay-gateway/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
 
@@ -40,7 +43,13 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		}
 	}()
 
+	info.StreamError = nil
 	streamingTimeout := time.Duration(constant.StreamingTimeout) * time.Second
+	// 首字超时，未配置时与流式超时相同
+	firstTokenTimeout := streamingTimeout
+	if constant.StreamFirstTokenTimeout > 0 {
+		firstTokenTimeout = time.Duration(constant.StreamFirstTokenTimeout) * time.Second
+	}
 
 	var (
 		stopChan   = make(chan bool, 3) // 增加缓冲区避免阻塞
@@ -49,6 +58,10 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		pingTicker *time.Ticker
 		writeMutex sync.Mutex     // Mutex to protect concurrent writes
 		wg         sync.WaitGroup // 用于等待所有 goroutine 退出
+
+		firstTokenTimer = time.NewTimer(firstTokenTimeout)
+		receivedData    atomic.Bool           // 是否已收到上游数据
+		scanErrChan     = make(chan error, 1) // 上游连接的读取错误
 	)
 
 	generalSettings := operation_setting.GetGeneralSetting()
@@ -75,6 +88,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		common.SafeSendBool(stopChan, true)
 
 		ticker.Stop()
+		firstTokenTimer.Stop()
 		if pingTicker != nil {
 			pingTicker.Stop()
 		}
@@ -210,6 +224,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			data = strings.TrimSuffix(data, "\r")
 			if !strings.HasPrefix(data, "[DONE]") {
 				info.SetFirstResponseTime()
+				receivedData.Store(true)
 
 				// 使用超时机制防止写操作阻塞
 				done := make(chan bool, 1)
@@ -244,20 +259,54 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		if err := scanner.Err(); err != nil {
 			if err != io.EOF {
 				logger.LogError(c, "scanner error: "+err.Error())
+				scanErrChan <- err
 			}
 		}
 	})
 
 	// 主循环等待完成或超时
-	select {
-	case <-ticker.C:
-		// 超时处理逻辑
-		logger.LogError(c, "streaming timeout")
-	case <-stopChan:
-		// 正常结束
-		logger.LogInfo(c, "streaming finished")
-	case <-c.Request.Context().Done():
-		// 客户端断开连接
-		logger.LogInfo(c, "client disconnected")
+	var streamErr error
+wait:
+	for {
+		select {
+		case <-ticker.C:
+			// 超时处理逻辑
+			logger.LogError(c, "streaming timeout")
+			streamErr = fmt.Errorf("streaming timeout: no data received within %s", streamingTimeout)
+			break wait
+		case <-firstTokenTimer.C:
+			if receivedData.Load() {
+				continue
+			}
+			logger.LogError(c, "first token timeout")
+			streamErr = fmt.Errorf("first token timeout: no data received within %s", firstTokenTimeout)
+			break wait
+		case <-stopChan:
+			// 正常结束
+			logger.LogInfo(c, "streaming finished")
+			select {
+			case err := <-scanErrChan:
+				streamErr = fmt.Errorf("upstream stream error: %w", err)
+			default:
+				if !receivedData.Load() {
+					streamErr = errors.New("upstream returned an empty stream")
+				}
+			}
+			break wait
+		case <-c.Request.Context().Done():
+			// 客户端断开连接
+			logger.LogInfo(c, "client disconnected")
+			break wait
+		}
+	}
+	if streamErr == nil {
+		return
+	}
+	info.StreamError = streamErr
+	// 已向客户端写出数据时无法再切换渠道，发送错误事件结束响应；否则由调用方重试其他渠道
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	if c.Writer.Written() {
+		StreamErrorEvent(c, info.RelayFormat, types.NewOpenAIError(streamErr, types.ErrorCodeStreamInterrupted, http.StatusBadGateway))
 	}
 }
@@ -96,6 +96,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
 	}
+	if spendingErr := service.CheckTokenSpendingLimit(c, info); spendingErr != nil {
+		taskErr = service.TaskErrorWrapperLocal(spendingErr.Err, string(spendingErr.GetErrorCode()), spendingErr.StatusCode)
+		return
+	}
 	quota := int(ratio * common.QuotaPerUnit)
 	if userQuota-quota < 0 {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
@@ -201,6 +205,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				})
 				model.UpdateUserUsedQuotaAndRequestCount(info.UserId, quota)
 				model.UpdateChannelUsedQuota(info.ChannelId, quota)
+				model.RecordChannelKeyUsage(info.ChannelId, info.ChannelMultiKeyMode, info.ChannelMultiKeyIndex, quota)
+				model.IncreaseTokenSpending(info.TokenId, quota)
+				model.IncreaseChildTokenSpending(info.ChildTokenId, quota)
+				model.RecordTokenUsage(info.TokenId, 0, quota)
 			}
 		}
 	}()
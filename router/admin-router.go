@@ -8,12 +8,13 @@ import (
 )
 
 // SetAdminRouter 设置管理 API 路由
-// 这些路由用于内部管理，如缓存管理等
+// 这些路由用于内部管理，如缓存管理等，需通过管理密钥或 HMAC 签名认证，所有调用都会写入审计日志
 func SetAdminRouter(router *gin.Engine) {
 	router.Use(middleware.CORS())
 
 	// 管理 API 路由组
 	adminRouter := router.Group("/api/admin")
+	adminRouter.Use(middleware.AdminAuth())
 	{
 		// Token 缓存管理
 		tokenCacheRouter := adminRouter.Group("/token/cache")
@@ -24,6 +25,51 @@ func SetAdminRouter(router *gin.Engine) {
 			tokenCacheRouter.POST("/batch-delete", controller.BatchDeleteTokenCache)
 		}
 
+		// Token 管理
+		tokenRouter := adminRouter.Group("/token")
+		{
+			tokenRouter.POST("", controller.CreateToken)
+			tokenRouter.GET("", controller.ListTokens)
+			tokenRouter.GET("/:id", controller.GetToken)
+			tokenRouter.PUT("/:id", controller.UpdateToken)
+			tokenRouter.DELETE("/:id", controller.DeleteToken)
+			tokenRouter.POST("/:id/enable", controller.EnableToken)
+			tokenRouter.POST("/:id/disable", controller.DisableToken)
+			// key 轮换
+			tokenRouter.POST("/rotate", controller.RotateTokenKey)
+		}
+
+		// 渠道熔断和并发
+		channelRouter := adminRouter.Group("/channel")
+		{
+			channelRouter.GET("/breakers", controller.GetChannelBreakers)
+			channelRouter.POST("/breakers/reset", controller.ResetChannelBreaker)
+			channelRouter.GET("/concurrency", controller.GetChannelConcurrencyStats)
+			// 路由诊断，不发送上游请求
+			channelRouter.POST("/route/explain", controller.ExplainChannelRoute)
+
+			// 渠道管理
+			channelRouter.GET("", controller.ListChannels)
+			channelRouter.GET("/search", controller.SearchChannels)
+			channelRouter.GET("/:id", controller.GetChannel)
+			channelRouter.POST("", controller.CreateChannel)
+			channelRouter.POST("/batch", controller.BatchCreateChannels)
+			channelRouter.PUT("/:id", controller.UpdateChannel)
+			channelRouter.DELETE("/:id", controller.DeleteChannel)
+			channelRouter.POST("/batch-delete", controller.BatchDeleteChannels)
+			channelRouter.POST("/tag/enable", controller.EnableChannelsByTag)
+			channelRouter.POST("/tag/disable", controller.DisableChannelsByTag)
+			channelRouter.PUT("/tag", controller.EditChannelsByTag)
+			channelRouter.POST("/tag/batch", controller.BatchSetChannelTag)
+			channelRouter.POST("/:id/keys/:index/enable", controller.EnableChannelKey)
+			channelRouter.POST("/:id/keys/:index/disable", controller.DisableChannelKey)
+			channelRouter.POST("/abilities/fix", controller.FixChannelAbilities)
+			channelRouter.POST("/cache/reload", controller.ReloadChannelCache)
+		}
+
+		// 缓存失效，通知所有节点
+		adminRouter.POST("/cache/invalidate", controller.InvalidateCache)
+
 		// User 缓存管理
 		userCacheRouter := adminRouter.Group("/user/cache")
 		{
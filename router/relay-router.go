@@ -48,6 +48,10 @@ func SetRelayRouter(router *gin.Engine) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
 	}
+	{
+		// 子令牌签发，不经过渠道分发
+		relayV1Router.POST("/tokens/child", controller.CreateChildToken)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
@@ -89,6 +89,22 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	return search
 }
 
+// ShouldCooldownChannelKey 多 key 渠道的 key 遇到限流（429）或额度不足时只临时冷却，不永久禁用；
+// key 无效（401、invalid_api_key）等错误仍按 ShouldDisableChannel 处理
+func ShouldCooldownChannelKey(err *types.NewAPIError) bool {
+	if err == nil || types.IsChannelError(err) || err.StatusCode == http.StatusUnauthorized {
+		return false
+	}
+	oaiErr := err.ToOpenAIError()
+	if oaiErr.Code == "invalid_api_key" {
+		return false
+	}
+	if err.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return oaiErr.Type == "insufficient_quota" || oaiErr.Code == "insufficient_quota"
+}
+
 func ShouldEnableChannel(newAPIError *types.NewAPIError, status int) bool {
 	if !common.AutomaticEnableChannelEnabled {
 		return false
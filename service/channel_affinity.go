@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/logger"
+	"relay-gateway/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 会话亲和的来源
+const (
+	ChannelAffinitySourceHeader = "header"
+	ChannelAffinitySourceUser   = "user"
+	ChannelAffinitySourcePrompt = "prompt"
+)
+
+// channelAffinityRequest 计算亲和 key 所需的请求字段，兼容 OpenAI 和 Claude 格式
+type channelAffinityRequest struct {
+	User     string            `json:"user"`
+	System   json.RawMessage   `json:"system"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// SetupChannelAffinity 根据会话 id 请求头、user 字段或提示词指纹计算会话亲和 key 并写入上下文，
+// 亲和 key 按用户、分组和模型隔离
+func SetupChannelAffinity(c *gin.Context, group string, modelName string) {
+	if !constant.ChannelAffinityEnabled {
+		return
+	}
+	source, value := "", ""
+	if constant.ChannelAffinityHeader != "" {
+		if sessionId := c.GetHeader(constant.ChannelAffinityHeader); sessionId != "" {
+			source, value = ChannelAffinitySourceHeader, sessionId
+		}
+	}
+	if source == "" {
+		var request channelAffinityRequest
+		if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+			return
+		}
+		if request.User != "" {
+			source, value = ChannelAffinitySourceUser, request.User
+		} else if fingerprint := channelAffinityPromptFingerprint(&request); fingerprint != "" {
+			source, value = ChannelAffinitySourcePrompt, fingerprint
+		}
+	}
+	if source == "" {
+		return
+	}
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%s|%s|%s", userId, group, modelName, source, value)))
+	common.SetContextKey(c, constant.ContextKeyChannelAffinityKey, hex.EncodeToString(sum[:]))
+	common.SetContextKey(c, constant.ContextKeyChannelAffinitySource, source)
+}
+
+// channelAffinityPromptFingerprint system 提示词加前几条消息的指纹，同一会话后续轮次的前缀不变
+func channelAffinityPromptFingerprint(request *channelAffinityRequest) string {
+	count := min(len(request.Messages), max(constant.ChannelAffinityPromptMessages, 0))
+	if len(request.System) == 0 && count == 0 {
+		return ""
+	}
+	h := sha256.New()
+	h.Write(request.System)
+	for _, message := range request.Messages[:count] {
+		h.Write([]byte{'\n'})
+		h.Write(message)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// getChannelAffinityChannel 首次选择渠道时优先使用会话亲和的渠道，渠道不可用时返回 nil
+func getChannelAffinityChannel(c *gin.Context, group string, modelName string) (*model.Channel, string) {
+	affinityKey := common.GetContextKeyString(c, constant.ContextKeyChannelAffinityKey)
+	if affinityKey == "" {
+		return nil, ""
+	}
+	affinity := model.GetChannelAffinity(affinityKey)
+	if affinity == nil {
+		return nil, ""
+	}
+	// auto 分组使用上次实际选中的分组
+	if group != "auto" && affinity.Group != group {
+		return nil, ""
+	}
+	if !model.IsChannelAffinityAvailable(affinity.Group, modelName, affinity.ChannelId) {
+		logger.LogDebug(c, "channel affinity unavailable, fallback to normal selection: channel_id=%s", affinity.ChannelId)
+		return nil, ""
+	}
+	channel, err := model.CacheGetChannel(affinity.ChannelId)
+	if err != nil || channel.Status != common.ChannelStatusEnabled {
+		return nil, ""
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelAffinityTarget, affinity)
+	return channel, affinity.Group
+}
+
+// RecordChannelAffinity 请求成功后记录会话当前使用的渠道和 key
+func RecordChannelAffinity(c *gin.Context, channelId string) {
+	affinityKey := common.GetContextKeyString(c, constant.ContextKeyChannelAffinityKey)
+	if affinityKey == "" {
+		return
+	}
+	group := c.GetString("auto_group")
+	if group == "" {
+		group = common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	}
+	keyIndex := -1
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	model.SetChannelAffinity(affinityKey, model.ChannelAffinity{
+		Group:     group,
+		ChannelId: channelId,
+		KeyIndex:  keyIndex,
+	})
+}
+
+// AppendPromptCacheInfo 在日志中记录提示词缓存命中率和会话亲和信息，promptTokens 为包含缓存部分的输入 token 数
+func AppendPromptCacheInfo(ctx *gin.Context, other map[string]interface{}, promptTokens int, cacheTokens int) {
+	if other == nil {
+		return
+	}
+	if promptTokens > 0 {
+		other["cache_hit_rate"] = float64(cacheTokens) / float64(promptTokens)
+	}
+	if source := common.GetContextKeyString(ctx, constant.ContextKeyChannelAffinitySource); source != "" {
+		other["channel_affinity"] = source
+		other["channel_affinity_hit"] = common.GetContextKeyBool(ctx, constant.ContextKeyChannelAffinityHit)
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"relay-gateway/constant"
+)
+
+// 对冲请求：启用对冲的分组或模型，非流式请求在首个渠道超过对冲延迟仍未返回时，
+// 向另一个渠道发出相同请求，先完成的结果返回给客户端。对冲延迟未配置时使用近期请求耗时的 p95
+
+const (
+	// 计算 p95 的滑动窗口大小
+	channelHedgeLatencyWindow = 200
+	// 样本数达到该值前使用默认延迟
+	channelHedgeMinSamples   = 20
+	channelHedgeDefaultDelay = time.Second
+	channelHedgeMinDelay     = 50 * time.Millisecond
+)
+
+type channelHedgeLatencies struct {
+	samples []time.Duration // 环形缓冲区
+	next    int
+}
+
+var (
+	channelHedgeLatencyStore     = make(map[string]*channelHedgeLatencies)
+	channelHedgeLatencyStoreLock sync.Mutex
+)
+
+// IsChannelHedgeEnabled 分组或模型是否启用了对冲请求
+func IsChannelHedgeEnabled(group string, modelName string) bool {
+	return slices.Contains(constant.ChannelHedgeGroups, group) || slices.Contains(constant.ChannelHedgeModels, modelName)
+}
+
+// RecordChannelHedgeLatency 记录启用对冲的请求从发出到完成的耗时
+func RecordChannelHedgeLatency(group string, modelName string, latency time.Duration) {
+	key := group + "|" + modelName
+	channelHedgeLatencyStoreLock.Lock()
+	defer channelHedgeLatencyStoreLock.Unlock()
+	l, ok := channelHedgeLatencyStore[key]
+	if !ok {
+		l = &channelHedgeLatencies{samples: make([]time.Duration, 0, channelHedgeLatencyWindow)}
+		channelHedgeLatencyStore[key] = l
+	}
+	if len(l.samples) < channelHedgeLatencyWindow {
+		l.samples = append(l.samples, latency)
+		return
+	}
+	l.samples[l.next] = latency
+	l.next = (l.next + 1) % channelHedgeLatencyWindow
+}
+
+// GetChannelHedgeDelay 发出对冲请求前的等待时间：优先使用 CHANNEL_HEDGE_DELAY_MS，否则为近期耗时的 p95
+func GetChannelHedgeDelay(group string, modelName string) time.Duration {
+	if constant.ChannelHedgeDelayMs > 0 {
+		return time.Duration(constant.ChannelHedgeDelayMs) * time.Millisecond
+	}
+	channelHedgeLatencyStoreLock.Lock()
+	l, ok := channelHedgeLatencyStore[group+"|"+modelName]
+	var samples []time.Duration
+	if ok && len(l.samples) >= channelHedgeMinSamples {
+		samples = slices.Clone(l.samples)
+	}
+	channelHedgeLatencyStoreLock.Unlock()
+	if len(samples) == 0 {
+		return channelHedgeDefaultDelay
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return max(samples[len(samples)*95/100], channelHedgeMinDelay)
+}
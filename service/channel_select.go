@@ -17,6 +17,18 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 	var err error
 	selectGroup := group
 	userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	// 首次选择时优先使用会话亲和的渠道，重试时正常选择
+	common.SetContextKey(c, constant.ContextKeyChannelAffinityHit, false)
+	if retry == 0 {
+		if affinityChannel, affinityGroup := getChannelAffinityChannel(c, group, modelName); affinityChannel != nil {
+			if group == "auto" {
+				c.Set("auto_group", affinityGroup)
+			}
+			common.SetContextKey(c, constant.ContextKeyChannelAffinityHit, true)
+			model.AcquireChannelBreaker(affinityChannel.Id, modelName)
+			return affinityChannel, affinityGroup, nil
+		}
+	}
 	if group == "auto" {
 		if len(setting.GetAutoGroups()) == 0 {
 			return nil, selectGroup, errors.New("auto groups is not enabled")
@@ -39,5 +51,9 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 			return nil, group, err
 		}
 	}
+	if channel != nil {
+		// 半开状态的熔断器占用一个试探名额
+		model.AcquireChannelBreaker(channel.Id, modelName)
+	}
 	return channel, selectGroup, nil
 }
@@ -49,6 +49,11 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if relayInfo.FallbackFromModel != "" {
+		// 请求的模型不可用，由降级链中的模型响应
+		other["fallback_from"] = relayInfo.FallbackFromModel
+		other["served_model"] = relayInfo.OriginModelName
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
@@ -62,6 +67,14 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		adminInfo["is_multi_key"] = true
 		adminInfo["multi_key_index"] = common.GetContextKeyInt(ctx, constant.ContextKeyChannelMultiKeyIndex)
 	}
+	if relayInfo.Hedge != nil {
+		// 实际发出了对冲请求时记录
+		if channels := relayInfo.Hedge.Gate.Channels(); len(channels) > 1 {
+			other["hedged"] = true
+			other["hedge_winner"] = relayInfo.Hedge.Index
+			adminInfo["hedge_channels"] = channels
+		}
+	}
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
 	return other
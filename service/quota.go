@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"strings"
 	"time"
 
 	"relay-gateway/common"
@@ -92,7 +91,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 		return err
 	}
 
-	token, err := model.GetTokenByKey(strings.TrimLeft(relayInfo.TokenKey, "sk-"), false)
+	token, err := getRelayToken(relayInfo)
 	if err != nil {
 		return err
 	}
@@ -161,6 +160,10 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 
 func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string,
 	usage *dto.RealtimeUsage, extraContent string) {
+	// 对冲请求只对胜出的尝试计费
+	if !relayInfo.ShouldBill() {
+		return
+	}
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	textInputTokens := usage.InputTokenDetails.TextTokens
@@ -216,6 +219,11 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.RecordChannelKeyUsage(relayInfo.ChannelId, relayInfo.ChannelMultiKeyMode, relayInfo.ChannelMultiKeyIndex, quota)
+		model.ReconcileChannelBudget(relayInfo.ChannelId, relayInfo.OriginModelName, relayInfo.PromptTokens, totalTokens)
+		model.IncreaseTokenSpending(relayInfo.TokenId, quota)
+		model.IncreaseChildTokenSpending(relayInfo.ChildTokenId, quota)
+		model.RecordTokenUsage(relayInfo.TokenId, totalTokens, quota)
 	}
 
 	logModel := modelName
@@ -241,6 +249,10 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 }
 
 func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) {
+	// 对冲请求只对胜出的尝试计费
+	if !relayInfo.ShouldBill() {
+		return
+	}
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
@@ -310,6 +322,11 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.RecordChannelKeyUsage(relayInfo.ChannelId, relayInfo.ChannelMultiKeyMode, relayInfo.ChannelMultiKeyIndex, quota)
+		model.ReconcileChannelBudget(relayInfo.ChannelId, relayInfo.OriginModelName, relayInfo.PromptTokens, totalTokens)
+		model.IncreaseTokenSpending(relayInfo.TokenId, quota)
+		model.IncreaseChildTokenSpending(relayInfo.ChildTokenId, quota)
+		model.RecordTokenUsage(relayInfo.TokenId, totalTokens, quota)
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -341,6 +358,8 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		cacheCreationTokens5m, cacheCreationRatio5m,
 		cacheCreationTokens1h, cacheCreationRatio1h,
 		modelPrice, relayInfo.PriceData.GroupRatioInfo.GroupSpecialRatio)
+	// Claude 的输入 token 不含缓存读取和缓存创建部分
+	AppendPromptCacheInfo(ctx, other, promptTokens+cacheTokens+cacheCreationTokens, cacheTokens)
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
@@ -380,6 +399,10 @@ func CalcOpenRouterCacheCreateTokens(usage dto.Usage, priceData types.PriceData)
 }
 
 func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	// 对冲请求只对胜出的尝试计费
+	if !relayInfo.ShouldBill() {
+		return
+	}
 
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	textInputTokens := usage.PromptTokensDetails.TextTokens
@@ -435,6 +458,11 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		model.RecordChannelKeyUsage(relayInfo.ChannelId, relayInfo.ChannelMultiKeyMode, relayInfo.ChannelMultiKeyIndex, quota)
+		model.ReconcileChannelBudget(relayInfo.ChannelId, relayInfo.OriginModelName, relayInfo.PromptTokens, totalTokens)
+		model.IncreaseTokenSpending(relayInfo.TokenId, quota)
+		model.IncreaseChildTokenSpending(relayInfo.ChildTokenId, quota)
+		model.RecordTokenUsage(relayInfo.TokenId, totalTokens, quota)
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -482,6 +510,14 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	})
 }
 
+// getRelayToken 获取本次请求计费的令牌，子令牌请求没有父令牌明文 key，按 id 查询
+func getRelayToken(relayInfo *relaycommon.RelayInfo) (*model.Token, error) {
+	if relayInfo.TokenKey == "" {
+		return model.GetTokenById(relayInfo.TokenId)
+	}
+	return model.GetTokenByKey(relayInfo.TokenKey, false)
+}
+
 func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
@@ -492,7 +528,7 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	//if relayInfo.TokenUnlimited {
 	//	return nil
 	//}
-	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+	token, err := getRelayToken(relayInfo)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/dto"
+	"relay-gateway/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+var tokenLifecycleOnce sync.Once
+
+// StartTokenLifecycleSweeper 定期将已过期、额度耗尽的令牌更新状态并清除缓存，并在令牌过期前提醒用户。
+// 只应在主节点启动
+func StartTokenLifecycleSweeper() {
+	tokenLifecycleOnce.Do(func() {
+		interval := time.Duration(constant.TokenLifecycleSweepInterval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+		common.SysLog(fmt.Sprintf("token lifecycle sweeper started with interval %s", interval))
+		for {
+			SweepTokenLifecycle()
+			time.Sleep(interval)
+		}
+	})
+}
+
+// SweepTokenLifecycle 执行一次令牌状态流转和过期提醒
+func SweepTokenLifecycle() {
+	if expired, err := model.SweepExpiredTokens(); err != nil {
+		common.SysError("failed to sweep expired tokens: " + err.Error())
+	} else if expired > 0 {
+		common.SysLog(fmt.Sprintf("token lifecycle: %d tokens marked as expired", expired))
+	}
+	if exhausted, err := model.SweepExhaustedTokens(); err != nil {
+		common.SysError("failed to sweep exhausted tokens: " + err.Error())
+	} else if exhausted > 0 {
+		common.SysLog(fmt.Sprintf("token lifecycle: %d tokens marked as exhausted", exhausted))
+	}
+	notifyExpiringTokens()
+}
+
+// notifyExpiringTokens 每个令牌只提醒一次，发送失败（如用户未配置通知方式）也不再重试，避免每轮巡检重复报错。
+// 通知在后台依次发送，避免用户的通知地址无响应时阻塞巡检
+func notifyExpiringTokens() {
+	if constant.TokenExpiryNotifyDays <= 0 {
+		return
+	}
+	tokens, err := model.GetTokensExpiringWithin(time.Duration(constant.TokenExpiryNotifyDays) * 24 * time.Hour)
+	if err != nil {
+		common.SysError("failed to query expiring tokens: " + err.Error())
+		return
+	}
+	notifies := make([]func(), 0, len(tokens))
+	for _, token := range tokens {
+		email, setting, err := model.GetUserNotifyInfo(token.UserId)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get notify info: user_id=%s, error=%v", token.UserId, err))
+			continue
+		}
+		if err := model.MarkTokenExpiryNotified(token.Id); err != nil {
+			common.SysError(fmt.Sprintf("failed to mark token expiry notified: token_id=%s, error=%v", token.Id, err))
+			continue
+		}
+		token := token
+		data := dto.NewNotify(dto.NotifyTypeTokenExpiring, "API Key 即将过期",
+			"您的 API Key {{value}}（{{value}}）将于 {{value}} 过期，请及时续期或更换。",
+			[]interface{}{token.Name, token.DisplayKey, token.ExpiresAt.Format("2006-01-02 15:04:05 MST")})
+		notifies = append(notifies, func() {
+			if err := NotifyUser(token.UserId, email, setting, data); err != nil {
+				common.SysError(fmt.Sprintf("failed to notify token expiry: token_id=%s, error=%v", token.Id, err))
+			}
+		})
+	}
+	if len(notifies) == 0 {
+		return
+	}
+	gopool.Go(func() {
+		for _, notify := range notifies {
+			notify()
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"relay-gateway/common"
+	"relay-gateway/constant"
+	"relay-gateway/logger"
+	"relay-gateway/model"
+	relaycommon "relay-gateway/relay/common"
+	"relay-gateway/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckTokenSpendingLimit 检查令牌当日/当月消费（以及子令牌消费）是否已达到上限，需在预扣费之前调用
+func CheckTokenSpendingLimit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	if relayInfo.IsPlayground || relayInfo.TokenId == "" {
+		return nil
+	}
+	if apiErr := checkChildTokenSpendingLimit(c, relayInfo); apiErr != nil {
+		return apiErr
+	}
+	token := &model.TokenEnhanced{
+		DailySpendingLimitCents:   common.GetContextKeyInt(c, constant.ContextKeyTokenDailySpendLimit),
+		MonthlySpendingLimitCents: common.GetContextKeyInt(c, constant.ContextKeyTokenMonthlySpendLimit),
+	}
+	if token.DailySpendingLimitCents <= 0 && token.MonthlySpendingLimitCents <= 0 {
+		return nil
+	}
+	dailySpent, monthlySpent, err := model.GetTokenSpending(relayInfo.TokenId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if token.CheckSpendingLimit(dailySpent, monthlySpent) {
+		return nil
+	}
+	var msg string
+	if token.DailySpendingLimitCents > 0 && dailySpent >= token.DailySpendingLimitCents {
+		msg = fmt.Sprintf("令牌今日消费已达上限, 已消费: %s, 每日上限: %s", logger.FormatQuota(dailySpent), logger.FormatQuota(token.DailySpendingLimitCents))
+	} else {
+		msg = fmt.Sprintf("令牌本月消费已达上限, 已消费: %s, 每月上限: %s", logger.FormatQuota(monthlySpent), logger.FormatQuota(token.MonthlySpendingLimitCents))
+	}
+	return types.NewErrorWithStatusCode(errors.New(msg), types.ErrorCodeTokenSpendingLimitExceeded, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// checkChildTokenSpendingLimit 子令牌消费上限在签发时写入 JWT，按 jti 单独计数
+func checkChildTokenSpendingLimit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	spendLimit := common.GetContextKeyInt(c, constant.ContextKeyChildTokenSpendLimit)
+	if relayInfo.ChildTokenId == "" || spendLimit <= 0 {
+		return nil
+	}
+	spent, err := model.GetChildTokenSpending(relayInfo.ChildTokenId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if spent < spendLimit {
+		return nil
+	}
+	msg := fmt.Sprintf("子令牌消费已达上限, 已消费: %s, 上限: %s", logger.FormatQuota(spent), logger.FormatQuota(spendLimit))
+	return types.NewErrorWithStatusCode(errors.New(msg), types.ErrorCodeChildTokenSpendingExceeded, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"relay-gateway/common"
+	"relay-gateway/dto"
+	"relay-gateway/setting/system_setting"
+)
+
+// notifyHttpClient 通知地址由用户填写，使用单独的客户端：设置较短的超时，
+// 并在建立连接时拒绝内网地址（包括域名解析和重定向后的地址）
+var notifyHttpClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				if system_setting.GetFetchSetting().AllowPrivateIp {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip != nil && (common.IsPrivateIP(ip) || ip.IsUnspecified()) {
+					return fmt.Errorf("private IP address not allowed: %s", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+	},
+	CheckRedirect: checkRedirect,
+}
+
+// formatNotifyContent 依次用 values 替换 content 中的 {{value}}
+func formatNotifyContent(data dto.Notify) string {
+	content := data.Content
+	for _, value := range data.Values {
+		content = strings.Replace(content, dto.ContentValueParam, fmt.Sprintf("%v", value), 1)
+	}
+	return content
+}
+
+// NotifyUser 按用户设置的通知方式发送通知，未设置时默认发送邮件
+func NotifyUser(userId string, userEmail string, userSetting dto.UserSetting, data dto.Notify) error {
+	notifyType := userSetting.NotifyType
+	if notifyType == "" {
+		notifyType = dto.NotifyTypeEmail
+	}
+
+	switch notifyType {
+	case dto.NotifyTypeEmail:
+		emailToUse := userSetting.NotificationEmail
+		if emailToUse == "" {
+			emailToUse = userEmail
+		}
+		if emailToUse == "" {
+			return fmt.Errorf("user %s has no email, skip sending email", userId)
+		}
+		return common.SendEmail(data.Title, emailToUse, formatNotifyContent(escapeNotifyValues(data)))
+	case dto.NotifyTypeWebhook:
+		if userSetting.WebhookUrl == "" {
+			return fmt.Errorf("user %s has no webhook url", userId)
+		}
+		return sendWebhookNotify(userSetting.WebhookUrl, userSetting.WebhookSecret, data)
+	case dto.NotifyTypeBark:
+		if userSetting.BarkUrl == "" {
+			return fmt.Errorf("user %s has no bark url", userId)
+		}
+		return sendBarkNotify(userSetting.BarkUrl, data)
+	case dto.NotifyTypeGotify:
+		if userSetting.GotifyUrl == "" || userSetting.GotifyToken == "" {
+			return fmt.Errorf("user %s has no gotify url or token", userId)
+		}
+		return sendGotifyNotify(userSetting.GotifyUrl, userSetting.GotifyToken, userSetting.GotifyPriority, data)
+	}
+	return fmt.Errorf("unknown notify type: %s", notifyType)
+}
+
+// escapeNotifyValues 邮件内容为 HTML，令牌名称等用户填写的值需要转义
+func escapeNotifyValues(data dto.Notify) dto.Notify {
+	values := make([]interface{}, len(data.Values))
+	for i, value := range data.Values {
+		values[i] = html.EscapeString(fmt.Sprintf("%v", value))
+	}
+	data.Values = values
+	return data
+}
+
+func doNotifyRequest(req *http.Request) error {
+	fetchSetting := system_setting.GetFetchSetting()
+	urlStr := req.URL.String()
+	if err := common.ValidateURLWithFetchSetting(urlStr, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return fmt.Errorf("notify request to %s blocked: %v", req.URL.Host, err)
+	}
+	resp, err := notifyHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notify request failed with status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func sendWebhookNotify(webhookUrl string, secret string, data dto.Notify) error {
+	payload, err := common.Marshal(map[string]interface{}{
+		"type":      data.Type,
+		"title":     data.Title,
+		"content":   data.Content,
+		"values":    data.Values,
+		"timestamp": time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// 使用密钥对请求体签名，接收方用同一密钥校验，密钥本身不随请求发送
+	if secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+common.GenerateHMACWithKey([]byte(secret), string(payload)))
+	}
+	return doNotifyRequest(req)
+}
+
+// sendBarkNotify Bark URL 中的 {{title}}、{{content}} 会被替换为通知标题和内容
+func sendBarkNotify(barkUrl string, data dto.Notify) error {
+	finalUrl := strings.ReplaceAll(barkUrl, "{{title}}", url.PathEscape(data.Title))
+	finalUrl = strings.ReplaceAll(finalUrl, "{{content}}", url.PathEscape(formatNotifyContent(data)))
+	req, err := http.NewRequest(http.MethodGet, finalUrl, nil)
+	if err != nil {
+		return err
+	}
+	return doNotifyRequest(req)
+}
+
+func sendGotifyNotify(gotifyUrl string, gotifyToken string, priority int, data dto.Notify) error {
+	if priority < 0 || priority > 10 {
+		priority = 5
+	}
+	payload, err := common.Marshal(map[string]interface{}{
+		"title":    data.Title,
+		"message":  formatNotifyContent(data),
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+	finalUrl := strings.TrimSuffix(gotifyUrl, "/") + "/message?token=" + url.QueryEscape(gotifyToken)
+	req, err := http.NewRequest(http.MethodPost, finalUrl, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doNotifyRequest(req)
+}
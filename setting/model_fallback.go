@@ -0,0 +1,51 @@
+package setting
+
+import (
+	"sync"
+
+	"relay-gateway/common"
+)
+
+// modelFallbackChains 按分组配置的模型降级链，"*" 对所有分组生效，
+// 例如 {"default": [["claude-sonnet-4", "claude-3-7-sonnet", "gpt-4.1"]]}
+var modelFallbackChains = map[string][][]string{}
+var modelFallbackChainsMutex sync.RWMutex
+
+func UpdateModelFallbackChainsByJsonString(jsonString string) error {
+	chains := make(map[string][][]string)
+	if err := common.Unmarshal([]byte(jsonString), &chains); err != nil {
+		return err
+	}
+	modelFallbackChainsMutex.Lock()
+	defer modelFallbackChainsMutex.Unlock()
+	modelFallbackChains = chains
+	return nil
+}
+
+func ModelFallbackChains2JsonString() string {
+	modelFallbackChainsMutex.RLock()
+	defer modelFallbackChainsMutex.RUnlock()
+	jsonBytes, err := common.Marshal(modelFallbackChains)
+	if err != nil {
+		return "{}"
+	}
+	return string(jsonBytes)
+}
+
+// GetModelFallbacks 返回分组下模型所在降级链中排在它之后的模型，分组未配置时使用 "*" 的配置
+func GetModelFallbacks(group string, modelName string) []string {
+	modelFallbackChainsMutex.RLock()
+	defer modelFallbackChainsMutex.RUnlock()
+	chains, ok := modelFallbackChains[group]
+	if !ok {
+		chains = modelFallbackChains["*"]
+	}
+	for _, chain := range chains {
+		for i, m := range chain {
+			if m == modelName {
+				return chain[i+1:]
+			}
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"relay-gateway/common"
 )
@@ -71,8 +72,10 @@ const (
 	ErrorCodeBadResponse            ErrorCode = "bad_response"
 	ErrorCodeBadResponseBody        ErrorCode = "bad_response_body"
 	ErrorCodeEmptyResponse          ErrorCode = "empty_response"
+	ErrorCodeStreamInterrupted      ErrorCode = "stream_interrupted"
 	ErrorCodeAwsInvokeError         ErrorCode = "aws_invoke_error"
 	ErrorCodeModelNotFound          ErrorCode = "model_not_found"
+	ErrorCodeChannelConcurrencyFull ErrorCode = "channel_concurrency_full"
 	ErrorCodePromptBlocked          ErrorCode = "prompt_blocked"
 
 	// sql error
@@ -82,6 +85,9 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeTokenSpendingLimitExceeded ErrorCode = "token_spending_limit_exceeded"
+	ErrorCodeTokenScopeDenied           ErrorCode = "token_scope_denied"
+	ErrorCodeChildTokenSpendingExceeded ErrorCode = "child_token_spending_exceeded"
 )
 
 type NewAPIError struct {
@@ -92,6 +98,7 @@ type NewAPIError struct {
 	errorType      ErrorType
 	errorCode      ErrorCode
 	StatusCode     int
+	RetryAfter     time.Duration // 上游响应的 Retry-After，没有时为 0
 }
 
 func (e *NewAPIError) GetErrorCode() ErrorCode {